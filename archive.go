@@ -0,0 +1,377 @@
+package hzip
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	errArchive       = errors.New("hzip: not a valid archive")
+	errArchiveName   = errors.New("hzip: invalid archive entry name")
+	errArchiveDup    = errors.New("hzip: duplicate archive entry name")
+	errArchiveDir    = errors.New("hzip: archive entry is a directory")
+	errArchiveClosed = errors.New("hzip: archive writer is closed")
+	errFileClosed    = errors.New("hzip: archive file is closed")
+)
+
+// archiveMagic starts and ends every archive.
+const archiveMagic = "HZAR"
+
+// Archive Format: many files, each compressed on its own, followed by a
+// central directory that describes them
+//	- 4 bytes: the magic "HZAR"
+//	- For each regular file, an hzip file with a checksum, see compress.go.
+//	  Each file has its own code table.
+//	- The central directory, with an entry for each file or directory:
+//		- 2 bytes (uint16): the length of the name, followed by the name
+//		- 4 bytes (uint32): the mode, as an os.FileMode
+//		- 8 bytes (int64) and 4 bytes (uint32): the modification time, in
+//		  seconds and nanoseconds since the Unix epoch
+//		- 8 bytes (uint64): the number of bytes in the original file
+//		- 8 bytes (uint64): the offset of the compressed file from the
+//		  start of the archive
+//		- 8 bytes (uint64): the number of bytes in the compressed file
+//	- 8 bytes (uint64): the offset of the central directory
+//	- 4 bytes (uint32): the number of entries in the central directory
+//	- 4 bytes: the magic "HZAR"
+// All multi-byte values are in little endian. Directories have no compressed
+// file, and their sizes and offsets are zero.
+
+const (
+	archiveEntrySize   = 2 + 4 + 8 + 4 + 8 + 8 + 8 // without the name
+	archiveTrailerSize = 8 + 4 + len(archiveMagic)
+)
+
+// An ArchiveHeader describes a file or directory in an archive.
+type ArchiveHeader struct {
+	// Name is the path of the file in the archive. It's slash-separated and
+	// relative, and it can't have empty, "." or ".." elements or
+	// backslashes.
+	Name    string
+	Mode    os.FileMode
+	ModTime time.Time
+	// Size and CompressedSize are the number of bytes in the original and
+	// compressed file. They're set by the ArchiveWriter.
+	Size           int64
+	CompressedSize int64
+}
+
+// FileInfo returns an os.FileInfo for the file or directory.
+func (h *ArchiveHeader) FileInfo() os.FileInfo {
+	return archiveFileInfo{h}
+}
+
+type archiveFileInfo struct {
+	h *ArchiveHeader
+}
+
+func (fi archiveFileInfo) Name() string       { return path.Base(fi.h.Name) }
+func (fi archiveFileInfo) Size() int64        { return fi.h.Size }
+func (fi archiveFileInfo) Mode() os.FileMode  { return fi.h.Mode }
+func (fi archiveFileInfo) ModTime() time.Time { return fi.h.ModTime }
+func (fi archiveFileInfo) IsDir() bool        { return fi.h.Mode.IsDir() }
+func (fi archiveFileInfo) Sys() interface{}   { return fi.h }
+
+// validArchiveName reports whether name can be the name of an entry in an
+// archive.
+func validArchiveName(name string) bool {
+	if name == "" || strings.ContainsRune(name, '\\') {
+		return false
+	}
+	for _, elem := range strings.Split(name, "/") {
+		if elem == "" || elem == "." || elem == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// An ArchiveWriter writes many files to an archive, compressing each of them
+// with its own code table.
+type ArchiveWriter struct {
+	bw     *bufio.Writer
+	cw     *countWriter
+	opts   []Option
+	files  []*archiveEntry
+	names  map[string]bool
+	last   *archiveFileWriter // file being written, if any
+	closed bool
+	err    error // the first error, returned by every later call
+}
+
+// archiveEntry is an entry in the central directory.
+type archiveEntry struct {
+	ArchiveHeader
+	offset int64
+}
+
+// NewArchiveWriter returns an ArchiveWriter that writes an archive to w. The
+// options are used for every file in the archive, which always has a
+// checksum.
+func NewArchiveWriter(w io.Writer, opts ...Option) *ArchiveWriter {
+	bw := bufio.NewWriter(w)
+	return &ArchiveWriter{
+		bw:    bw,
+		cw:    &countWriter{w: bw},
+		opts:  append(opts[:len(opts):len(opts)], WithChecksum()),
+		names: make(map[string]bool),
+	}
+}
+
+// Create adds a file or directory to the archive and returns an io.Writer for
+// the contents of the file, which are compressed once the next file is added
+// or the archive is closed. Only the name, mode and modification time are
+// taken from h. Writing to a directory fails.
+func (a *ArchiveWriter) Create(h *ArchiveHeader) (io.Writer, error) {
+	if a.err != nil {
+		return nil, a.err
+	}
+	if a.closed {
+		return nil, errArchiveClosed
+	}
+	if err := a.closeFile(); err != nil {
+		a.err = err
+		return nil, err
+	}
+	if !validArchiveName(h.Name) {
+		return nil, errArchiveName
+	}
+	if a.names[h.Name] {
+		return nil, errArchiveDup
+	}
+	if err := a.writeMagic(); err != nil {
+		a.err = err
+		return nil, err
+	}
+	a.names[h.Name] = true
+	e := &archiveEntry{ArchiveHeader: ArchiveHeader{
+		Name:    h.Name,
+		Mode:    h.Mode,
+		ModTime: h.ModTime,
+	}}
+	a.files = append(a.files, e)
+	if h.Mode.IsDir() {
+		return dirWriter{}, nil
+	}
+	e.offset = a.cw.n
+	a.last = &archiveFileWriter{w: NewWriter(a.cw, a.opts...), e: e}
+	return a.last, nil
+}
+
+// writeMagic writes the magic at the start of the archive, if it hasn't been
+// written yet.
+func (a *ArchiveWriter) writeMagic() error {
+	if a.cw.n > 0 {
+		return nil
+	}
+	_, err := io.WriteString(a.cw, archiveMagic)
+	return err
+}
+
+// closeFile compresses the file being written, if any.
+func (a *ArchiveWriter) closeFile() error {
+	f := a.last
+	if f == nil {
+		return nil
+	}
+	a.last = nil
+	f.closed = true
+	if err := f.w.Close(); err != nil {
+		return err
+	}
+	f.e.CompressedSize = a.cw.n - f.e.offset
+	return nil
+}
+
+// Close compresses the last file, writes the central directory and flushes
+// the archive to the underlying io.Writer. It does not close the underlying
+// io.Writer. Once writing the archive has failed, Close and Create return the
+// first error.
+func (a *ArchiveWriter) Close() error {
+	if a.err == nil && !a.closed {
+		a.err = a.close()
+		a.closed = true
+	}
+	return a.err
+}
+
+func (a *ArchiveWriter) close() error {
+	if err := a.closeFile(); err != nil {
+		return err
+	}
+	if err := a.writeMagic(); err != nil {
+		return err
+	}
+	dir := a.cw.n
+	for _, e := range a.files {
+		if err := writeName(a.cw, e.Name); err != nil {
+			return err
+		}
+		fields := []interface{}{
+			uint32(e.Mode),
+			e.ModTime.Unix(),
+			uint32(e.ModTime.Nanosecond()),
+			uint64(e.Size),
+			uint64(e.offset),
+			uint64(e.CompressedSize),
+		}
+		for _, v := range fields {
+			if err := binary.Write(a.cw, binary.LittleEndian, v); err != nil {
+				return err
+			}
+		}
+	}
+	if err := binary.Write(a.cw, binary.LittleEndian, uint64(dir)); err != nil {
+		return err
+	}
+	if err := binary.Write(a.cw, binary.LittleEndian, uint32(len(a.files))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(a.cw, archiveMagic); err != nil {
+		return err
+	}
+	return a.bw.Flush()
+}
+
+// archiveFileWriter is the io.Writer for a file in an archive. It's closed
+// once the next file is added or the archive is closed.
+type archiveFileWriter struct {
+	w      *Writer
+	e      *archiveEntry
+	closed bool
+}
+
+func (f *archiveFileWriter) Write(p []byte) (int, error) {
+	if f.closed {
+		return 0, errFileClosed
+	}
+	n, err := f.w.Write(p)
+	f.e.Size += int64(n)
+	return n, err
+}
+
+// dirWriter is the io.Writer for a directory in an archive.
+type dirWriter struct{}
+
+func (dirWriter) Write(p []byte) (int, error) {
+	return 0, errArchiveDir
+}
+
+// An ArchiveReader reads the files in an archive.
+type ArchiveReader struct {
+	// File has the files and directories in the archive, in the order they
+	// were added.
+	File []*ArchiveFile
+
+	// The index used by the fs.FS methods, see fs.go
+	once     sync.Once
+	byName   map[string]*ArchiveFile   // files and directories by name
+	children map[string][]*ArchiveFile // files in each directory
+}
+
+// An ArchiveFile is a file or directory in an archive.
+type ArchiveFile struct {
+	ArchiveHeader
+	r      io.ReaderAt
+	offset int64
+	opts   []Option
+}
+
+// NewArchiveReader reads the central directory of the archive in r, which is
+// size bytes long. The options are used when files are opened.
+func NewArchiveReader(r io.ReaderAt, size int64, opts ...Option) (*ArchiveReader, error) {
+	if size < int64(len(archiveMagic)+archiveTrailerSize) {
+		return nil, errArchive
+	}
+	// ReadAt may return io.EOF along with a full read at the end
+	magic := make([]byte, len(archiveMagic))
+	if n, err := r.ReadAt(magic, 0); n < len(magic) {
+		return nil, archiveError(err)
+	}
+	trailer := make([]byte, archiveTrailerSize)
+	if n, err := r.ReadAt(trailer, size-int64(archiveTrailerSize)); n < len(trailer) {
+		return nil, archiveError(err)
+	}
+	if string(magic) != archiveMagic || string(trailer[12:]) != archiveMagic {
+		return nil, errArchive
+	}
+	dir := binary.LittleEndian.Uint64(trailer)
+	count := binary.LittleEndian.Uint32(trailer[8:])
+	end := uint64(size) - uint64(archiveTrailerSize)
+	if dir < uint64(len(archiveMagic)) || dir > end || uint64(count) > (end-dir)/archiveEntrySize {
+		return nil, errArchive
+	}
+
+	br := bufio.NewReader(io.NewSectionReader(r, int64(dir), int64(end-dir)))
+	ar := &ArchiveReader{File: make([]*ArchiveFile, 0, count)}
+	names := make(map[string]bool, count)
+	for i := uint32(0); i < count; i++ {
+		name, err := readName(br)
+		if err != nil {
+			return nil, archiveError(err)
+		}
+		var e struct {
+			Mode           uint32
+			Sec            int64
+			Nsec           uint32
+			Size           uint64
+			Offset         uint64
+			CompressedSize uint64
+		}
+		if err := binary.Read(br, binary.LittleEndian, &e); err != nil {
+			return nil, archiveError(err)
+		}
+		if !validArchiveName(name) || e.Nsec >= 1e9 || e.Offset > dir || e.CompressedSize > dir-e.Offset {
+			return nil, errArchive
+		}
+		if names[name] {
+			return nil, errArchiveDup
+		}
+		names[name] = true
+		ar.File = append(ar.File, &ArchiveFile{
+			ArchiveHeader: ArchiveHeader{
+				Name:           name,
+				Mode:           os.FileMode(e.Mode),
+				ModTime:        time.Unix(e.Sec, int64(e.Nsec)),
+				Size:           int64(e.Size),
+				CompressedSize: int64(e.CompressedSize),
+			},
+			r:      r,
+			offset: int64(e.Offset),
+			opts:   opts,
+		})
+	}
+	return ar, nil
+}
+
+// archiveError turns running out of data in the central directory into
+// errArchive.
+func archiveError(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return errArchive
+	}
+	return err
+}
+
+// Open returns a Reader for the contents of the file. Only this file is read
+// from the archive. Opening a directory fails.
+func (f *ArchiveFile) Open() (*Reader, error) {
+	if f.Mode.IsDir() {
+		return nil, errArchiveDir
+	}
+	hr, err := NewReader(bufio.NewReader(io.NewSectionReader(f.r, f.offset, f.CompressedSize)), f.opts...)
+	if err != nil {
+		return nil, err
+	}
+	if hr.Header().Size != f.Size {
+		return nil, errArchive
+	}
+	return hr, nil
+}
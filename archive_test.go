@@ -0,0 +1,238 @@
+package hzip
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testArchiveFile struct {
+	name string
+	mode os.FileMode
+	data []byte
+}
+
+var testArchiveFiles = []testArchiveFile{
+	{"docs", os.ModeDir | 0755, nil},
+	{"docs/hello.txt", 0644, []byte("Hello World\n")},
+	{"docs/empty", 0600, nil},
+	{"random.bin", 0755, genRandBytes(10000)},
+}
+
+func writeTestArchive(t *testing.T, opts ...Option) []byte {
+	buf := new(bytes.Buffer)
+	aw := NewArchiveWriter(buf, opts...)
+	mtime := time.Unix(1000000000, 123456789)
+	for _, f := range testArchiveFiles {
+		w, err := aw.Create(&ArchiveHeader{Name: f.name, Mode: f.mode, ModTime: mtime})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(f.data); f.mode.IsDir() {
+			assert.Equal(t, errArchiveDir, err)
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := aw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithRLE()}, {WithBackend(TANS)}} {
+		data := writeTestArchive(t, opts...)
+		ar, err := NewArchiveReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, len(testArchiveFiles), len(ar.File))
+		for i, f := range ar.File {
+			want := testArchiveFiles[i]
+			assert.Equal(t, want.name, f.Name)
+			assert.Equal(t, want.mode, f.Mode)
+			assert.True(t, time.Unix(1000000000, 123456789).Equal(f.ModTime))
+			assert.Equal(t, int64(len(want.data)), f.Size)
+			fi := f.FileInfo()
+			assert.Equal(t, want.mode.IsDir(), fi.IsDir())
+			assert.Equal(t, want.mode, fi.Mode())
+
+			r, err := f.Open()
+			if want.mode.IsDir() {
+				assert.Equal(t, errArchiveDir, err)
+				assert.Equal(t, int64(0), f.CompressedSize)
+				continue
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.True(t, r.Header().HasChecksum)
+			got, err := ioutil.ReadAll(r)
+			assert.NoError(t, err)
+			assert.Equal(t, string(want.data), string(got))
+		}
+	}
+}
+
+func TestArchiveEmpty(t *testing.T) {
+	buf := new(bytes.Buffer)
+	if err := NewArchiveWriter(buf).Close(); err != nil {
+		t.Fatal(err)
+	}
+	ar, err := NewArchiveReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.NoError(t, err)
+	assert.Empty(t, ar.File)
+}
+
+func TestArchiveWriterErrors(t *testing.T) {
+	aw := NewArchiveWriter(ioutil.Discard)
+	for _, name := range []string{"", "/abs", "a/../b", "./a", "a//b", "a/", `a\b`} {
+		_, err := aw.Create(&ArchiveHeader{Name: name})
+		assert.Equal(t, errArchiveName, err, name)
+	}
+	_, err := aw.Create(&ArchiveHeader{Name: "a"})
+	assert.NoError(t, err)
+	_, err = aw.Create(&ArchiveHeader{Name: "a"})
+	assert.Equal(t, errArchiveDup, err)
+	assert.NoError(t, aw.Close())
+	_, err = aw.Create(&ArchiveHeader{Name: "b"})
+	assert.Equal(t, errArchiveClosed, err)
+}
+
+func TestArchiveWriterLateWrite(t *testing.T) {
+	buf := new(bytes.Buffer)
+	aw := NewArchiveWriter(buf)
+	a, err := aw.Create(&ArchiveHeader{Name: "a", Mode: 0644})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Write([]byte("aaa"))
+	b, err := aw.Create(&ArchiveHeader{Name: "b", Mode: 0644})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = a.Write([]byte("late"))
+	assert.Equal(t, errFileClosed, err)
+	b.Write([]byte("bbb"))
+	assert.NoError(t, aw.Close())
+	_, err = b.Write([]byte("late"))
+	assert.Equal(t, errFileClosed, err)
+
+	ar, err := NewArchiveReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []string{"aaa", "bbb"} {
+		r, err := ar.File[i].Open()
+		if assert.NoError(t, err) {
+			got, err := ioutil.ReadAll(r)
+			assert.NoError(t, err)
+			assert.Equal(t, want, string(got))
+		}
+	}
+}
+
+// limitWriter fails once more than n bytes have been written to it.
+type limitWriter struct {
+	n int
+}
+
+var errLimit = errors.New("write limit reached")
+
+func (w *limitWriter) Write(p []byte) (int, error) {
+	if len(p) > w.n {
+		return 0, errLimit
+	}
+	w.n -= len(p)
+	return len(p), nil
+}
+
+func TestArchiveWriterStickyError(t *testing.T) {
+	// The first file is too big to fit, so compressing it fails when the
+	// next one is added, and every later call fails the same way
+	aw := NewArchiveWriter(&limitWriter{n: 100})
+	w, err := aw.Create(&ArchiveHeader{Name: "a", Mode: 0644})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(genRandBytes(100000))
+	_, err = aw.Create(&ArchiveHeader{Name: "b", Mode: 0644})
+	assert.Equal(t, errLimit, err)
+	_, err = aw.Create(&ArchiveHeader{Name: "c", Mode: 0644})
+	assert.Equal(t, errLimit, err)
+	assert.Equal(t, errLimit, aw.Close())
+	assert.Equal(t, errLimit, aw.Close())
+}
+
+func TestArchiveReaderErrors(t *testing.T) {
+	data := writeTestArchive(t)
+	open := func(data []byte) error {
+		_, err := NewArchiveReader(bytes.NewReader(data), int64(len(data)))
+		return err
+	}
+	assert.Equal(t, errArchive, open(nil))
+	assert.Equal(t, errArchive, open(data[:len(data)-1]))
+	assert.Equal(t, errArchive, open(append([]byte("x"), data[1:]...)))
+
+	// The central directory doesn't fit
+	bad := append([]byte(nil), data...)
+	bad[len(bad)-8]++
+	assert.Equal(t, errArchive, open(bad))
+
+	// Corrupt data is caught by the checksum
+	ar, err := NewArchiveReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hello := ar.File[1]
+	bad = append([]byte(nil), data...)
+	bad[hello.offset+hello.CompressedSize-1] ^= 0xff
+	ar, err = NewArchiveReader(bytes.NewReader(bad), int64(len(bad)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := ar.File[1].Open()
+	if err == nil {
+		_, err = ioutil.ReadAll(r)
+	}
+	assert.Error(t, err)
+}
+
+// eofReaderAt returns io.EOF along with reads that reach the end of the data,
+// which io.ReaderAt allows.
+type eofReaderAt struct {
+	r *bytes.Reader
+}
+
+func (r eofReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := r.r.ReadAt(p, off)
+	if err == nil && off+int64(n) == r.r.Size() {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func TestArchiveReaderEOF(t *testing.T) {
+	data := writeTestArchive(t)
+	ar, err := NewArchiveReader(eofReaderAt{bytes.NewReader(data)}, int64(len(data)))
+	if assert.NoError(t, err) {
+		assert.Equal(t, len(testArchiveFiles), len(ar.File))
+		r, err := ar.File[len(ar.File)-1].Open()
+		if assert.NoError(t, err) {
+			got, err := ioutil.ReadAll(r)
+			assert.NoError(t, err)
+			assert.Equal(t, testArchiveFiles[len(testArchiveFiles)-1].data, got)
+		}
+	}
+
+	// A size past the end of the data is still caught
+	_, err = NewArchiveReader(eofReaderAt{bytes.NewReader(data)}, int64(len(data))+1)
+	assert.Equal(t, errArchive, err)
+}
@@ -0,0 +1,286 @@
+package hzip
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"sort"
+)
+
+var errFreqTable = errors.New("hzip: invalid frequency table")
+
+// A freqTable holds symbol frequencies normalized so that they add up to a
+// power of two. It's the model shared by the entropy coders other than
+// Huffman coding, and it's stored in the header in place of the code table:
+//   - 1 byte: the table log, so that the frequencies add up to 1<<log
+//   - For each symbol in the alphabet (sorted by symbol value):
+//   - 1 byte: the symbol itself, or 2 bytes (uint16) with flagWide
+//   - 2 bytes (uint16): the normalized frequency minus one
+type freqTable struct {
+	log   uint
+	syms  []uint16       // symbols in increasing order
+	freqs []uint32       // normalized frequency of each symbol
+	cum   []uint32       // cum[i] is the sum of freqs[:i]
+	index map[uint16]int // map from symbol to its index in syms
+}
+
+const maxTableLog = 16
+
+// newFreqTable normalizes the given frequencies so that they add up to
+// 1<<log. Every symbol keeps a frequency of at least one.
+func newFreqTable(freqs map[uint16]int, log uint) *freqTable {
+	t := &freqTable{log: log}
+	var total uint64
+	for sym, freq := range freqs {
+		if freq > 0 {
+			t.syms = append(t.syms, sym)
+			total += uint64(freq)
+		}
+	}
+	sort.Slice(t.syms, func(i, j int) bool { return t.syms[i] < t.syms[j] })
+	if len(t.syms) == 0 {
+		t.init()
+		return t
+	}
+
+	size := uint64(1) << log
+	t.freqs = make([]uint32, len(t.syms))
+	var sum uint64
+	for i, sym := range t.syms {
+		f := uint64(freqs[sym]) * size / total
+		if f == 0 {
+			f = 1
+		}
+		t.freqs[i] = uint32(f)
+		sum += f
+	}
+	// Rounding leaves the sum a little off, so take the difference from
+	// the most frequent symbols, which can afford it the most
+	order := make([]int, len(t.syms))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return t.freqs[order[i]] > t.freqs[order[j]] })
+	if sum < size {
+		t.freqs[order[0]] += uint32(size - sum)
+	}
+	for _, i := range order {
+		if sum <= size {
+			break
+		}
+		d := uint64(t.freqs[i] - 1)
+		if d > sum-size {
+			d = sum - size
+		}
+		t.freqs[i] -= uint32(d)
+		sum -= d
+	}
+	t.init()
+	return t
+}
+
+// init fills in the cumulative frequencies and the symbol index.
+func (t *freqTable) init() {
+	t.cum = make([]uint32, len(t.syms)+1)
+	t.index = make(map[uint16]int, len(t.syms))
+	for i, sym := range t.syms {
+		t.cum[i+1] = t.cum[i] + t.freqs[i]
+		t.index[sym] = i
+	}
+}
+
+// tableLog returns the smallest table log from min up to maxTableLog that
+// leaves room for every symbol in the alphabet.
+func tableLog(alphabetSize int, min uint) uint {
+	log := min
+	for log < maxTableLog && 1<<log < alphabetSize {
+		log++
+	}
+	return log
+}
+
+func (t *freqTable) writeTo(w io.Writer, wide bool) error {
+	if err := binary.Write(w, binary.LittleEndian, byte(t.log)); err != nil {
+		return err
+	}
+	for i, sym := range t.syms {
+		if err := writeSymbol(w, sym, wide); err != nil {
+			return err
+		}
+		if err := binary.Write(w, binary.LittleEndian, uint16(t.freqs[i]-1)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readFreqTable reads a table with the given number of symbols.
+func readFreqTable(r io.Reader, size uint32, wide bool) (*freqTable, error) {
+	var log byte
+	if err := binary.Read(r, binary.LittleEndian, &log); err != nil {
+		return nil, err
+	}
+	if log > maxTableLog || size > 1<<log {
+		return nil, errFreqTable
+	}
+	t := &freqTable{log: uint(log)}
+	var sum uint32
+	for i := uint32(0); i < size; i++ {
+		sym, err := readSymbol(r, wide)
+		if err != nil {
+			return nil, err
+		}
+		var freq uint16
+		if err := binary.Read(r, binary.LittleEndian, &freq); err != nil {
+			return nil, err
+		}
+		if len(t.syms) > 0 && sym <= t.syms[len(t.syms)-1] {
+			return nil, errFreqTable
+		}
+		t.syms = append(t.syms, sym)
+		t.freqs = append(t.freqs, uint32(freq)+1)
+		sum += uint32(freq) + 1
+	}
+	if size > 0 && sum != 1<<log {
+		return nil, errFreqTable
+	}
+	t.init()
+	return t, nil
+}
+
+// Arithmetic coding, as described in "Arithmetic Coding for Data
+// Compression" by Witten, Neal and Cleary, with 32 bits of precision. The
+// frequencies add up to at most 1<<maxTableLog, which is well within the 30
+// bits that this precision allows for.
+const (
+	arithTop     = 1<<32 - 1
+	arithHalf    = 1 << 31
+	arithQuarter = 1 << 30
+)
+
+type arithEncoder struct {
+	w         *BitWriter
+	t         *freqTable
+	low, high uint64
+	pending   int // number of opposite bits to write after the next bit
+}
+
+func newArithEncoder(w *BitWriter, t *freqTable) *arithEncoder {
+	return &arithEncoder{w: w, t: t, high: arithTop}
+}
+
+func (e *arithEncoder) encode(sym uint16) error {
+	i := e.t.index[sym]
+	rng := e.high - e.low + 1
+	e.high = e.low + rng*uint64(e.t.cum[i+1])>>e.t.log - 1
+	e.low = e.low + rng*uint64(e.t.cum[i])>>e.t.log
+	for {
+		switch {
+		case e.high < arithHalf:
+			if err := e.writeBit('0'); err != nil {
+				return err
+			}
+		case e.low >= arithHalf:
+			if err := e.writeBit('1'); err != nil {
+				return err
+			}
+			e.low -= arithHalf
+			e.high -= arithHalf
+		case e.low >= arithQuarter && e.high < 3*arithQuarter:
+			e.pending++
+			e.low -= arithQuarter
+			e.high -= arithQuarter
+		default:
+			return nil
+		}
+		e.low <<= 1
+		e.high = e.high<<1 | 1
+	}
+}
+
+// writeBit writes the bit followed by any pending opposite bits.
+func (e *arithEncoder) writeBit(bit byte) error {
+	if _, err := e.w.WriteBit(bit); err != nil {
+		return err
+	}
+	opposite := byte('0' + '1' - bit)
+	for ; e.pending > 0; e.pending-- {
+		if _, err := e.w.WriteBit(opposite); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// finish writes enough bits to identify the final interval. The decoder
+// reads zeroes past the end of the data, which completes the value.
+func (e *arithEncoder) finish() error {
+	e.pending++
+	if e.low < arithQuarter {
+		return e.writeBit('0')
+	}
+	return e.writeBit('1')
+}
+
+type arithDecoder struct {
+	t                *freqTable
+	low, high, value uint64
+	started          bool
+}
+
+func newArithDecoder(t *freqTable) *arithDecoder {
+	return &arithDecoder{t: t, high: arithTop}
+}
+
+func (d *arithDecoder) Decode(r *BitReader) (uint16, error) {
+	if !d.started {
+		for i := 0; i < 32; i++ {
+			if err := d.readBit(r); err != nil {
+				return 0, err
+			}
+		}
+		d.started = true
+	}
+	rng := d.high - d.low + 1
+	count := ((d.value-d.low+1)<<d.t.log - 1) / rng
+	// Find the symbol whose range of cumulative frequencies has count in it
+	i := sort.Search(len(d.t.syms), func(i int) bool { return uint64(d.t.cum[i+1]) > count })
+	if i == len(d.t.syms) {
+		return 0, errFreqTable
+	}
+	d.high = d.low + rng*uint64(d.t.cum[i+1])>>d.t.log - 1
+	d.low = d.low + rng*uint64(d.t.cum[i])>>d.t.log
+	for {
+		switch {
+		case d.high < arithHalf:
+		case d.low >= arithHalf:
+			d.low -= arithHalf
+			d.high -= arithHalf
+			d.value -= arithHalf
+		case d.low >= arithQuarter && d.high < 3*arithQuarter:
+			d.low -= arithQuarter
+			d.high -= arithQuarter
+			d.value -= arithQuarter
+		default:
+			return d.t.syms[i], nil
+		}
+		d.low <<= 1
+		d.high = d.high<<1 | 1
+		if err := d.readBit(r); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// readBit shifts the next bit into the value. Past the end of the data, the
+// bits are zeroes.
+func (d *arithDecoder) readBit(r *BitReader) error {
+	bit, err := r.ReadBit()
+	if err == io.EOF {
+		bit = '0'
+	} else if err != nil {
+		return err
+	}
+	d.value = d.value<<1 | uint64(bit-'0')
+	return nil
+}
@@ -0,0 +1,104 @@
+package hzip
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewFreqTable(t *testing.T) {
+	for _, freqs := range []map[uint16]int{
+		{'a': 1},
+		{'a': 1, 'b': 1, 'c': 1},
+		{'a': 1000000, 'b': 1, 'c': 1, 'd': 2},
+		{'a': 3, 'b': 0},
+	} {
+		table := newFreqTable(freqs, 12)
+		assert.Equal(t, uint32(1<<12), table.cum[len(table.syms)])
+		for i, sym := range table.syms {
+			assert.True(t, table.freqs[i] >= 1)
+			assert.Equal(t, i, table.index[sym])
+		}
+	}
+
+	// An alphabet that fills up the whole table
+	freqs := make(map[uint16]int)
+	for i := 0; i < 1<<8; i++ {
+		freqs[uint16(i)] = rand.Intn(100) + 1
+	}
+	freqs[0] = 1000000
+	table := newFreqTable(freqs, 8)
+	for i := range table.syms {
+		assert.Equal(t, uint32(1), table.freqs[i])
+	}
+
+	assert.Equal(t, uint(11), tableLog(10, 11))
+	assert.Equal(t, uint(12), tableLog(3000, 11))
+	assert.Equal(t, uint(16), tableLog(MaxSymbols, 11))
+}
+
+func TestArithmeticRoundTrip(t *testing.T) {
+	roundTrip(t, nil, WithBackend(Arithmetic))
+	roundTrip(t, []byte("X"), WithBackend(Arithmetic))
+	roundTrip(t, []byte("XXXXXXXXXX"), WithBackend(Arithmetic))
+	roundTrip(t, []byte("Hello World"), WithBackend(Arithmetic))
+	for i := 0; i < 300; i++ {
+		roundTrip(t, genRandBytes(i*7), WithBackend(Arithmetic))
+	}
+	roundTrip(t, bytes.Repeat([]byte("aaaaaaaaaaaaaaab"), 1000), WithBackend(Arithmetic), WithRLE())
+}
+
+func TestArithmeticSymbols(t *testing.T) {
+	syms := make([]uint16, 10000)
+	for i := range syms {
+		syms[i] = uint16(rand.Intn(MaxSymbols))
+	}
+	buf := new(bytes.Buffer)
+	w := NewSymbolWriter(buf, WithBackend(Arithmetic))
+	w.WriteSymbols(syms)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewSymbolReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, syms, readAllSymbols(t, r))
+}
+
+func TestArithmeticSkewed(t *testing.T) {
+	// Mostly one symbol, which Huffman coding can't encode in less than a
+	// bit
+	data := make([]byte, 100000)
+	for i := range data {
+		if rand.Intn(100) == 0 {
+			data[i] = byte(rand.Intn(4))
+		}
+	}
+	huffman := roundTrip(t, data)
+	arith := roundTrip(t, data, WithBackend(Arithmetic))
+	if len(arith) >= len(huffman)/2 {
+		t.Errorf("arithmetic coding gave %d bytes; want less than half of %d", len(arith), len(huffman))
+	}
+}
+
+func TestMalformedFreqTable(t *testing.T) {
+	header := []byte{
+		0x01, 0x00, 0x00, 0x00, // original file size
+		0x02, 0x00, 0x00, byte(Arithmetic) << backendShift, // alphabet size and flags
+	}
+	// Frequencies that don't add up to 1<<log
+	data := append(header, 0x02, 'a', 0x00, 0x00, 'b', 0x00, 0x00)
+	assert.Equal(t, errFreqTable, tryDecompress(t, data))
+	// Symbols out of order
+	data = append(header, 0x01, 'b', 0x00, 0x00, 'a', 0x00, 0x00, 0x00)
+	assert.Equal(t, errFreqTable, tryDecompress(t, data))
+	// Table log too large
+	data = append(header, 0x20)
+	assert.Equal(t, errFreqTable, tryDecompress(t, data))
+	// Valid table
+	data = append(header, 0x01, 'a', 0x00, 0x00, 'b', 0x00, 0x00, 0x00)
+	assert.Nil(t, tryDecompress(t, data))
+}
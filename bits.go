@@ -7,7 +7,8 @@ import (
 
 const byteSize = 8
 
-type bitWriter struct {
+// A BitWriter writes individual bits to an io.Writer.
+type BitWriter struct {
 	w      io.Writer
 	buf    byte   // bit buffer
 	mem    []byte // slice of memory to avoid allocation in calls to w.Write
@@ -15,12 +16,12 @@ type bitWriter struct {
 	closed bool
 }
 
-// newBitWriter returns an io.Writer that proxies Write calls to the underlying
+// NewBitWriter returns a BitWriter that proxies Write calls to the underlying
 // io.Writer, except it has methods that are designed to write individual bits.
 // The bits are encoded from left to right, and the final byte is padded on the
 // right with zeroes.
-func newBitWriter(w io.Writer) *bitWriter {
-	return &bitWriter{
+func NewBitWriter(w io.Writer) *BitWriter {
+	return &BitWriter{
 		w:     w,
 		shift: byteSize - 1,
 	}
@@ -29,7 +30,7 @@ func newBitWriter(w io.Writer) *bitWriter {
 // Write writes the given slice to the underlying io.Writer. If the Write
 // method is called while the bit buffer has bits in it, then it will panic.
 // Call Flush to write and clear the buffered bits.
-func (w *bitWriter) Write(p []byte) (int, error) {
+func (w *BitWriter) Write(p []byte) (int, error) {
 	if w.shift != byteSize-1 {
 		panic("hzip: invalid write call - bit buffer not empty")
 	}
@@ -42,7 +43,7 @@ func (w *bitWriter) Write(p []byte) (int, error) {
 // the size of a byte or Flush is called.
 //
 // Will panic if the bit isn't an ASCII '1' or '0' character.
-func (w *bitWriter) WriteBit(bit byte) (int, error) {
+func (w *BitWriter) WriteBit(bit byte) (int, error) {
 	if bit != '0' && bit != '1' {
 		panic(fmt.Errorf("hzip: invalid bit %q", bit))
 	}
@@ -57,8 +58,8 @@ func (w *bitWriter) WriteBit(bit byte) (int, error) {
 	return 1, nil
 }
 
-// Calls WriteBit on each byte in the slice.
-func (w *bitWriter) WriteBits(p []byte) (int, error) {
+// WriteBits calls WriteBit on each byte in the slice.
+func (w *BitWriter) WriteBits(p []byte) (int, error) {
 	ntotal := 0
 	for i := 0; i < len(p); i++ {
 		n, err := w.WriteBit(p[i])
@@ -70,8 +71,8 @@ func (w *bitWriter) WriteBits(p []byte) (int, error) {
 	return ntotal, nil
 }
 
-// Calls WriteBit on each byte in the string.
-func (w *bitWriter) WriteBitString(s string) (int, error) {
+// WriteBitString calls WriteBit on each byte in the string.
+func (w *BitWriter) WriteBitString(s string) (int, error) {
 	ntotal := 0
 	for i := 0; i < len(s); i++ {
 		n, err := w.WriteBit(s[i])
@@ -83,7 +84,9 @@ func (w *bitWriter) WriteBitString(s string) (int, error) {
 	return ntotal, nil
 }
 
-func (w *bitWriter) Close() error {
+// Close flushes any buffered bits. It does not close the underlying
+// io.Writer.
+func (w *BitWriter) Close() error {
 	if w.closed {
 		return nil
 	}
@@ -93,7 +96,7 @@ func (w *bitWriter) Close() error {
 
 // Flush ends the current byte, padding it on the right with zeroes, and
 // writes it to the underlying io.Writer.
-func (w *bitWriter) Flush() error {
+func (w *BitWriter) Flush() error {
 	if w.shift != byteSize-1 {
 		if w.mem != nil {
 			w.mem = w.mem[:0]
@@ -109,18 +112,19 @@ func (w *bitWriter) Flush() error {
 	return nil
 }
 
-type bitReader struct {
+// A BitReader reads individual bits from an io.Reader.
+type BitReader struct {
 	r    io.Reader
 	buf  byte   // bit buffer
 	mem  []byte // slice of memory to avoid allocation
 	mask byte   // current bit mask
 }
 
-// newBitReader returns an io.Reader that proxies Read calls to the underlying
+// NewBitReader returns a BitReader that proxies Read calls to the underlying
 // io.Reader, except that it has methods that are designed to read individual
 // bits. Data is buffered a byte at a time.
-func newBitReader(r io.Reader) *bitReader {
-	return &bitReader{
+func NewBitReader(r io.Reader) *BitReader {
+	return &BitReader{
 		r:   r,
 		mem: make([]byte, 1),
 	}
@@ -129,7 +133,7 @@ func newBitReader(r io.Reader) *bitReader {
 // Read reads len(p) bytes from the underlying io.Reader. If the Read method is
 // called while the bit buffer has bits in it, then it will panic. Call Reset
 // to clear the bit buffer.
-func (r *bitReader) Read(p []byte) (int, error) {
+func (r *BitReader) Read(p []byte) (int, error) {
 	if r.mask != 0x00 {
 		panic("hzip: invalid read call - bit buffer not empty")
 	}
@@ -137,13 +141,15 @@ func (r *bitReader) Read(p []byte) (int, error) {
 }
 
 // ReadBit reads a single bit and returns it as an ASCII '0' or '1'.
-func (r *bitReader) ReadBit() (byte, error) {
+func (r *BitReader) ReadBit() (byte, error) {
 	if r.mask == 0x00 {
-		r.mask = 0x80
-		_, err := r.r.Read(r.mem)
+		// ReadFull handles readers that return the last byte together
+		// with io.EOF
+		_, err := io.ReadFull(r.r, r.mem)
 		if err != nil {
 			return 0x00, err
 		}
+		r.mask = 0x80
 		r.buf = r.mem[0]
 	}
 	ret := byte('0')
@@ -155,7 +161,7 @@ func (r *bitReader) ReadBit() (byte, error) {
 }
 
 // Reset clears the bit buffer.
-func (r *bitReader) Reset() {
+func (r *BitReader) Reset() {
 	r.buf = 0x00
 	r.mask = 0x00
 }
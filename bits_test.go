@@ -3,7 +3,9 @@ package hzip
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"testing"
+	"testing/iotest"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -14,7 +16,7 @@ func TestWriteBit(t *testing.T) {
 		err error
 	)
 	buf := new(bytes.Buffer)
-	w := newBitWriter(buf)
+	w := NewBitWriter(buf)
 
 	assert.Panics(t, func() {
 		w.WriteBit('2')
@@ -44,7 +46,7 @@ func TestWriteBits(t *testing.T) {
 		err error
 	)
 	buf := new(bytes.Buffer)
-	w := newBitWriter(buf)
+	w := NewBitWriter(buf)
 
 	n, err = w.WriteBits([]byte(""))
 	assert.Equal(t, 0, n)
@@ -66,7 +68,7 @@ func TestWriteBitString(t *testing.T) {
 		err error
 	)
 	buf := new(bytes.Buffer)
-	w := newBitWriter(buf)
+	w := NewBitWriter(buf)
 
 	n, err = w.WriteBitString("")
 	assert.Equal(t, 0, n)
@@ -83,7 +85,7 @@ func TestWriteBitString(t *testing.T) {
 func TestBitFlush(t *testing.T) {
 	var err error
 	buf := new(bytes.Buffer)
-	w := newBitWriter(buf)
+	w := NewBitWriter(buf)
 
 	// Empty flush
 	err = w.Flush()
@@ -114,13 +116,13 @@ func TestBitFlush(t *testing.T) {
 func TestCloseBitWriter(t *testing.T) {
 	var err error
 	buf := new(bytes.Buffer)
-	w := newBitWriter(buf)
+	w := NewBitWriter(buf)
 
 	// Empty close
 	w.Close()
 	assert.Empty(t, buf.Bytes())
 
-	w = newBitWriter(buf)
+	w = NewBitWriter(buf)
 	w.WriteBitString("01100101010")
 	assert.Equal(t, []byte{0x65}, buf.Bytes())
 	err = w.Close()
@@ -134,7 +136,7 @@ func TestCloseBitWriter(t *testing.T) {
 
 func TestInterleavedBitWrites(t *testing.T) {
 	buf := new(bytes.Buffer)
-	w := newBitWriter(buf)
+	w := NewBitWriter(buf)
 
 	w.Write([]byte{0x01, 0x02})
 	assert.Equal(t, []byte{0x01, 0x02}, buf.Bytes())
@@ -150,3 +152,18 @@ func TestInterleavedBitWrites(t *testing.T) {
 	w.Write([]byte{0x03})
 	assert.Equal(t, []byte{0x01, 0x02, 0x65, 0x40, 0x03}, buf.Bytes())
 }
+
+func TestReadBitDataWithEOF(t *testing.T) {
+	// iotest.DataErrReader returns the last byte together with io.EOF
+	r := NewBitReader(iotest.DataErrReader(bytes.NewReader([]byte{0xa0})))
+	var bits []byte
+	for {
+		bit, err := r.ReadBit()
+		if err != nil {
+			assert.Equal(t, io.EOF, err)
+			break
+		}
+		bits = append(bits, bit)
+	}
+	assert.Equal(t, "10100000", string(bits))
+}
@@ -1,27 +1,18 @@
 package main
 
 import (
-	"bufio"
-	"io"
-	"log"
 	"os"
 
-	"github.com/burakguven/hzip"
+	"github.com/burakguven/hzip/internal/cli"
 )
 
 func main() {
-	log.SetPrefix("hunzip: ")
-	log.SetFlags(0)
-
-	var err error
-	r, err := hzip.NewReader(bufio.NewReader(os.Stdin))
-	if err != nil {
-		log.Fatal(err)
-	}
-	bufw := bufio.NewWriter(os.Stdout)
-	_, err = io.Copy(bufw, r)
-	if err != nil {
-		log.Fatal(err)
+	c := &cli.Command{
+		Name:       "hunzip",
+		Decompress: true,
+		Stdin:      os.Stdin,
+		Stdout:     os.Stdout,
+		Stderr:     os.Stderr,
 	}
-	bufw.Flush()
+	os.Exit(c.Run(os.Args[1:]))
 }
@@ -1,25 +1,17 @@
 package main
 
 import (
-	"bufio"
-	"io"
-	"log"
 	"os"
 
-	"github.com/burakguven/hzip"
+	"github.com/burakguven/hzip/internal/cli"
 )
 
 func main() {
-	log.SetPrefix("hzip: ")
-	log.SetFlags(0)
-
-	bufw := bufio.NewWriter(os.Stdout)
-	w := hzip.NewWriter(bufw)
-	if _, err := io.Copy(w, os.Stdin); err != nil {
-		log.Fatal(err)
-	}
-	if err := w.Close(); err != nil {
-		log.Fatal(err)
+	c := &cli.Command{
+		Name:   "hzip",
+		Stdin:  os.Stdin,
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
 	}
-	bufw.Flush()
+	os.Exit(c.Run(os.Args[1:]))
 }
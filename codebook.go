@@ -0,0 +1,349 @@
+package hzip
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+var errCodeLengths = errors.New("hzip: invalid code lengths")
+
+// A Codebook maps symbols to Huffman codewords and back. Codewords are
+// represented as strings of ASCII '1' and '0' characters, which is what
+// BitWriter.WriteBitString and BitReader.ReadBit work with.
+//
+// A Codebook is safe for concurrent use once it has been built.
+type Codebook struct {
+	codes   map[uint16]string // map from symbol to code
+	symbols map[string]uint16 // map from code to symbol
+
+	idOnce sync.Once
+	id     uint32 // see ID
+
+	trieOnce sync.Once
+	trie     [][2]int32 // see decodeTrie
+}
+
+// NewCodebook builds an optimal Huffman codebook for the given symbol
+// frequencies. Symbols with a frequency of zero are left out.
+func NewCodebook(freqs map[uint16]int) *Codebook {
+	nonzero := make(map[uint16]int, len(freqs))
+	for sym, freq := range freqs {
+		if freq > 0 {
+			nonzero[sym] = freq
+		}
+	}
+	return newCodebook(buildCodeMap(nonzero))
+}
+
+// NewCodebookFromLengths builds a canonical Huffman codebook from the given
+// codeword lengths, as in DEFLATE: shorter codes come first and codes of the
+// same length are assigned in increasing symbol order. Symbols with a length
+// of zero are left out, except for a single-symbol codebook, whose only
+// codeword is empty.
+func NewCodebookFromLengths(lengths map[uint16]int) (*Codebook, error) {
+	var syms []uint16
+	for sym, n := range lengths {
+		if n < 0 || n > 0xff {
+			return nil, errCodeLengths
+		}
+		if n > 0 || len(lengths) == 1 {
+			syms = append(syms, sym)
+		}
+	}
+	sort.Slice(syms, func(i, j int) bool {
+		a, b := lengths[syms[i]], lengths[syms[j]]
+		if a != b {
+			return a < b
+		}
+		return syms[i] < syms[j]
+	})
+	codes := make(map[uint16]string, len(syms))
+	// next is the next codeword, as a big-endian bit string of the
+	// current length
+	var next []byte
+	for i, sym := range syms {
+		n := lengths[sym]
+		if i > 0 {
+			// Increment the previous codeword, which fails if all
+			// the codewords of this length are used up
+			k := len(next) - 1
+			for ; k >= 0 && next[k] == '1'; k-- {
+				next[k] = '0'
+			}
+			if k < 0 {
+				return nil, errCodeLengths
+			}
+			next[k] = '1'
+		}
+		for len(next) < n {
+			next = append(next, '0')
+		}
+		codes[sym] = string(next)
+	}
+	return newCodebook(codes), nil
+}
+
+func newCodebook(codes map[uint16]string) *Codebook {
+	c := &Codebook{
+		codes:   codes,
+		symbols: make(map[string]uint16, len(codes)),
+	}
+	for sym, code := range codes {
+		c.symbols[code] = sym
+	}
+	return c
+}
+
+// Len returns the number of symbols in the codebook.
+func (c *Codebook) Len() int {
+	return len(c.codes)
+}
+
+// Symbols returns the symbols in the codebook in increasing order.
+func (c *Codebook) Symbols() []uint16 {
+	return sortedSymbols(c.codes)
+}
+
+// Code returns the codeword for the given symbol, and false if the symbol
+// isn't in the codebook.
+func (c *Codebook) Code(sym uint16) (string, bool) {
+	code, ok := c.codes[sym]
+	return code, ok
+}
+
+// Lengths returns the length of the codeword of every symbol in the codebook.
+func (c *Codebook) Lengths() map[uint16]int {
+	lengths := make(map[uint16]int, len(c.codes))
+	for sym, code := range c.codes {
+		lengths[sym] = len(code)
+	}
+	return lengths
+}
+
+// Encode writes the codeword for the given symbol to w.
+func (c *Codebook) Encode(w *BitWriter, sym uint16) error {
+	code, ok := c.codes[sym]
+	if !ok {
+		return fmt.Errorf("hzip: symbol %d not in codebook", sym)
+	}
+	_, err := w.WriteBitString(code)
+	return err
+}
+
+// Decode reads a codeword from r and returns its symbol. It returns
+// io.ErrUnexpectedEOF if r ends in the middle of a codeword.
+func (c *Codebook) Decode(r *BitReader) (uint16, error) {
+	// Read one bit at a time until there's a code match
+	var mem [64]byte
+	code := mem[:0]
+	for {
+		if sym, ok := c.symbols[string(code)]; ok {
+			return sym, nil
+		}
+		bit, err := r.ReadBit()
+		if err == io.EOF {
+			return 0, io.ErrUnexpectedEOF
+		} else if err != nil {
+			return 0, err
+		}
+		code = append(code, bit)
+	}
+}
+
+// sortedSymbols returns the symbols in the code map in increasing order.
+func sortedSymbols(codes map[uint16]string) []uint16 {
+	syms := make([]uint16, 0, len(codes))
+	for sym := range codes {
+		syms = append(syms, sym)
+	}
+	sort.Slice(syms, func(i, j int) bool { return syms[i] < syms[j] })
+	return syms
+}
+
+// decodeTrie returns the codes as a binary trie for decoding a bit at a time
+// without map lookups. Each node has the index of the next node for a 0 and a
+// 1 bit, or the complement of a symbol for a leaf, or zero if no code goes
+// that way. The root is node 0. Codes that start with a shorter code can never
+// be decoded, so they're left out.
+func (c *Codebook) decodeTrie() [][2]int32 {
+	c.trieOnce.Do(func() {
+		codes := make([]string, 0, len(c.symbols))
+		for code := range c.symbols {
+			codes = append(codes, code)
+		}
+		sort.Slice(codes, func(i, j int) bool {
+			if len(codes[i]) != len(codes[j]) {
+				return len(codes[i]) < len(codes[j])
+			}
+			return codes[i] < codes[j]
+		})
+		trie := make([][2]int32, 1, 2*len(codes)+1)
+	insert:
+		for _, code := range codes {
+			if code == "" {
+				continue
+			}
+			node := int32(0)
+			for i := 0; i < len(code)-1; i++ {
+				next := &trie[node][code[i]-'0']
+				if *next < 0 {
+					continue insert
+				}
+				if *next == 0 {
+					*next = int32(len(trie))
+					trie = append(trie, [2]int32{})
+				}
+				node = *next
+			}
+			if last := &trie[node][code[len(code)-1]-'0']; *last == 0 {
+				*last = ^int32(c.symbols[code])
+			}
+		}
+		c.trie = trie
+	})
+	return c.trie
+}
+
+// wide reports whether any of the symbols in the codebook is too large to be
+// stored in a byte.
+func (c *Codebook) wide() bool {
+	for sym := range c.codes {
+		if sym > 0xff {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteTo writes the codebook to w in the same format that's used for the
+// code table in the header of compressed files: the size of the alphabet and
+// flags, followed by the table itself. See compress.go.
+func (c *Codebook) WriteTo(w io.Writer) (int64, error) {
+	cw := &countWriter{w: w}
+	bw := NewBitWriter(cw)
+	var flags uint32
+	if c.wide() {
+		flags = flagWide
+	}
+	if err := binary.Write(bw, binary.LittleEndian, uint32(len(c.codes))|flags<<flagsShift); err != nil {
+		return cw.n, err
+	}
+	err := c.writeTable(bw, flags&flagWide != 0)
+	return cw.n, err
+}
+
+// ReadCodebook reads a codebook written by Codebook.WriteTo. It doesn't read
+// past the end of the codebook.
+func ReadCodebook(r io.Reader) (*Codebook, error) {
+	br := NewBitReader(r)
+	var size uint32
+	err := binary.Read(br, binary.LittleEndian, &size)
+	if err == nil {
+		flags := size >> flagsShift
+		if flags&^flagWide != 0 {
+			return nil, errFlags
+		}
+		var c *Codebook
+		c, err = readTable(br, size&alphabetSizeMask, flags&flagWide != 0)
+		if err == nil {
+			return c, nil
+		}
+	}
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return nil, err
+}
+
+// writeTable writes the code table for every symbol in the codebook.
+func (c *Codebook) writeTable(w *BitWriter, wide bool) error {
+	for _, sym := range c.Symbols() {
+		code := c.codes[sym]
+		// The symbol itself
+		if err := writeSymbol(w, sym, wide); err != nil {
+			return err
+		}
+		// The number of bits in its codeword
+		if err := binary.Write(w, binary.LittleEndian, byte(len(code))); err != nil {
+			return err
+		}
+		// The codeword, padded on the right with 0 bits. Note that
+		// it's legal to have an empty codeword, but it only happens
+		// when the alphabet has a single symbol.
+		if _, err := w.WriteBitString(code); err != nil {
+			return err
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readTable reads a code table with the given number of symbols.
+func readTable(r *BitReader, size uint32, wide bool) (*Codebook, error) {
+	codes := make(map[uint16]string)
+	mem := make([]byte, 1)
+	for i := uint32(0); i < size; i++ {
+		// Symbol
+		symbol, err := readSymbol(r, wide)
+		if err != nil {
+			return nil, err
+		}
+
+		// Number of bits in code
+		if _, err := r.Read(mem); err != nil {
+			return nil, err
+		}
+		codeLen := mem[0]
+
+		// The code itself
+		var codeBits []byte
+		for k := byte(0); k < codeLen; k++ {
+			bit, err := r.ReadBit()
+			if err != nil {
+				return nil, err
+			}
+			codeBits = append(codeBits, bit)
+		}
+		codes[symbol] = string(codeBits)
+		// Get rid of extra padding at the end, if any
+		r.Reset()
+	}
+	return newCodebook(codes), nil
+}
+
+func writeSymbol(w io.Writer, sym uint16, wide bool) error {
+	if wide {
+		return binary.Write(w, binary.LittleEndian, sym)
+	}
+	return binary.Write(w, binary.LittleEndian, byte(sym))
+}
+
+func readSymbol(r io.Reader, wide bool) (uint16, error) {
+	if wide {
+		var sym uint16
+		err := binary.Read(r, binary.LittleEndian, &sym)
+		return sym, err
+	}
+	var sym byte
+	err := binary.Read(r, binary.LittleEndian, &sym)
+	return uint16(sym), err
+}
+
+// countWriter counts the number of bytes written to the underlying
+// io.Writer.
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,112 @@
+package hzip
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCodebookFromLengths(t *testing.T) {
+	// The example from RFC 1951, section 3.2.2
+	lengths := map[uint16]int{
+		'A': 3, 'B': 3, 'C': 3, 'D': 3, 'E': 3, 'F': 2, 'G': 4, 'H': 4,
+	}
+	wantCodes := map[uint16]string{
+		'A': "010", 'B': "011", 'C': "100", 'D': "101",
+		'E': "110", 'F': "00", 'G': "1110", 'H': "1111",
+	}
+	c, err := NewCodebookFromLengths(lengths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(wantCodes), c.Len())
+	for sym, want := range wantCodes {
+		code, ok := c.Code(sym)
+		assert.True(t, ok)
+		if code != want {
+			t.Errorf("c.Code(%q) == %q; want %q", rune(sym), code, want)
+		}
+	}
+	assert.Equal(t, lengths, c.Lengths())
+
+	// Single symbol
+	c, err = NewCodebookFromLengths(map[uint16]int{0x1234: 0})
+	assert.Nil(t, err)
+	code, ok := c.Code(0x1234)
+	assert.True(t, ok)
+	assert.Equal(t, "", code)
+
+	// Zero lengths are left out
+	c, err = NewCodebookFromLengths(map[uint16]int{1: 1, 2: 0, 3: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, []uint16{1, 3}, c.Symbols())
+
+	// Too many short codes
+	_, err = NewCodebookFromLengths(map[uint16]int{1: 1, 2: 1, 3: 1})
+	assert.Equal(t, errCodeLengths, err)
+	_, err = NewCodebookFromLengths(map[uint16]int{1: -1, 2: 1})
+	assert.Equal(t, errCodeLengths, err)
+}
+
+func TestCodebookEncodeDecode(t *testing.T) {
+	c := NewCodebook(map[uint16]int{'a': 10, 'b': 3, 'c': 1, 0x1000: 5, 'z': 0})
+	assert.Equal(t, 4, c.Len())
+	_, ok := c.Code('z')
+	assert.False(t, ok)
+
+	msg := []uint16{'a', 'b', 0x1000, 'c', 'a', 'a'}
+	buf := new(bytes.Buffer)
+	w := NewBitWriter(buf)
+	for _, sym := range msg {
+		assert.Nil(t, c.Encode(w, sym))
+	}
+	assert.NotNil(t, c.Encode(w, 'z'))
+	w.Close()
+
+	r := NewBitReader(bytes.NewReader(buf.Bytes()))
+	for _, want := range msg {
+		sym, err := c.Decode(r)
+		assert.Nil(t, err)
+		assert.Equal(t, want, sym)
+	}
+	// Only padding is left
+	for {
+		if _, err := c.Decode(r); err != nil {
+			assert.Equal(t, io.ErrUnexpectedEOF, err)
+			break
+		}
+	}
+}
+
+func TestCodebookSerialization(t *testing.T) {
+	for _, freqs := range []map[uint16]int{
+		{},
+		{'x': 1},
+		{'a': 10, 'b': 3, 'c': 1},
+		{'a': 10, 0xffff: 3, 0x100: 1},
+	} {
+		c := NewCodebook(freqs)
+		buf := new(bytes.Buffer)
+		n, err := c.WriteTo(buf)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(buf.Len()), n)
+
+		// Reading the codebook doesn't consume what comes after it
+		buf.WriteString("rest")
+		r := bytes.NewReader(buf.Bytes())
+		c2, err := ReadCodebook(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, c.codes, c2.codes)
+		assert.Equal(t, 4, r.Len())
+
+		// Truncated codebook
+		if n > 4 {
+			_, err = ReadCodebook(bytes.NewReader(buf.Bytes()[:n-1]))
+			assert.Equal(t, io.ErrUnexpectedEOF, err)
+		}
+	}
+}
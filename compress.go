@@ -4,51 +4,170 @@ package hzip
 
 import (
 	"encoding/binary"
+	"fmt"
+	"hash/crc32"
 	"io"
 )
 
+// Header flags, stored in the high byte of the alphabet size field.
+const (
+	flagRLE  = 0x01 // data is run-length encoded, see rle.go
+	flagWide = 0x02 // symbols are stored as 2 bytes instead of 1
+	flagDict = 0x04 // codes come from a preset codebook, see dict.go
+	flagCRC  = 0x20 // the header has a checksum of the original data
+	flagName = 0x40 // the header has the name of the original file
+
+	// The backend that compresses the symbols, see options.go. Huffman
+	// coding is zero, so it's the backend for files without flags.
+	backendMask  = 0x18
+	backendShift = 3
+
+	knownFlags = flagRLE | flagWide | flagDict | backendMask | flagCRC | flagName
+
+	alphabetSizeMask = 0x00ffffff
+	flagsShift       = 24
+)
+
 type Writer struct {
-	w      *bitWriter
-	buf    []byte
-	freqs  map[byte]int
-	codes  map[byte]string
-	closed bool
+	w        *BitWriter
+	cw       *countWriter // counts the bytes written, for Stats
+	opts     options
+	buf      []byte
+	syms     []uint16 // run-length encoded buf, or symbols from a SymbolWriter
+	wide     bool     // symbols come from a SymbolWriter rather than buf
+	counts   [256]int // frequency of each byte in buf
+	freqs    map[uint16]int
+	cb       *Codebook
+	table    *freqTable // model for backends other than Huffman
+	dict     *Codebook  // preset codebook, if any
+	cancel   canceler
+	progress progress
+	header   int64 // size of the header, once it's been written
+	closed   bool
 }
 
 // NewWriter returns an io.Writer that compresses the data written to it using
 // the Huffman coding algorithm and writes it to the given io.Writer.
 //
 // No data is written to the underlying io.Writer until Close is called.
-func NewWriter(w io.Writer) *Writer {
+func NewWriter(w io.Writer, opts ...Option) *Writer {
+	o := newOptions(opts)
+	cw := &countWriter{w: w}
 	return &Writer{
-		w:     newBitWriter(w),
-		freqs: make(map[byte]int),
+		w:        NewBitWriter(cw),
+		cw:       cw,
+		opts:     o,
+		freqs:    make(map[uint16]int),
+		cancel:   canceler{ctx: o.ctx},
+		progress: progress{fn: o.progress},
 	}
 }
 
 func (w *Writer) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	w.count(p)
+	return len(p), nil
+}
+
+// WriteString is like Write, but writes the contents of the string s.
+func (w *Writer) WriteString(s string) (int, error) {
+	w.buf = append(w.buf, s...)
+	w.count(w.buf[len(w.buf)-len(s):])
+	return len(s), nil
+}
+
+// WriteByte writes a single byte.
+func (w *Writer) WriteByte(c byte) error {
+	w.buf = append(w.buf, c)
+	w.counts[c]++
+	return nil
+}
+
+// ReadFrom reads data from r until io.EOF, straight into the Writer's
+// buffer.
+func (w *Writer) ReadFrom(r io.Reader) (int64, error) {
+	var total int64
+	for {
+		if err := w.cancel.err(); err != nil {
+			return total, err
+		}
+		if len(w.buf) == cap(w.buf) {
+			// Let append pick how much to grow the buffer by
+			w.buf = append(w.buf, 0)[:len(w.buf)]
+		}
+		n, err := r.Read(w.buf[len(w.buf):cap(w.buf)])
+		w.count(w.buf[len(w.buf) : len(w.buf)+n])
+		w.buf = w.buf[:len(w.buf)+n]
+		total += int64(n)
+		if err == io.EOF {
+			return total, nil
+		}
+		if err != nil {
+			return total, err
+		}
+	}
+}
+
+func (w *Writer) count(p []byte) {
 	for _, b := range p {
-		w.freqs[b]++
-		w.buf = append(w.buf, b)
+		w.counts[b]++
 	}
-	return len(p), nil
 }
 
 // Close writes the compressed data to the underlying io.Writer and closes the
 // Writer. It does not close the underlying io.Writer.  Nothing is written to
 // the underlying io.Writer until Close is called because of the nature of the
-// algorithm.
+// algorithm. Close fails if 4 GiB or more, or 2^32 or more symbols, were
+// written, since the size wouldn't fit in the header.
 func (w *Writer) Close() error {
 	if w.closed {
 		return nil
 	}
-	w.codes = buildCodeMap(w.freqs)
+	if err := w.cancel.err(); err != nil {
+		return err
+	}
+	if len(w.opts.name) > 0xffff {
+		return errNameLength
+	}
+	if int64(w.size()) > maxSize {
+		return errTooLarge
+	}
+	if w.opts.rle && !w.wide {
+		w.syms = rleEncode(w.buf)
+		for _, sym := range w.syms {
+			w.freqs[sym]++
+		}
+	} else if !w.wide {
+		for b, n := range w.counts {
+			if n > 0 {
+				w.freqs[uint16(b)] = n
+			}
+		}
+	}
+	switch {
+	case w.backend() == Arithmetic:
+		w.table = newFreqTable(w.freqs, maxTableLog)
+	case w.backend() == TANS:
+		w.table = newFreqTable(w.freqs, tableLog(len(w.freqs), minTANSLog))
+	case w.dict != nil:
+		for sym := range w.freqs {
+			if _, ok := w.dict.codes[sym]; !ok {
+				return fmt.Errorf("hzip: symbol %d not in dictionary", sym)
+			}
+		}
+		w.cb = w.dict
+	default:
+		w.cb = NewCodebook(w.freqs)
+	}
 	if err := w.writeHeader(); err != nil {
 		return err
 	}
-	if _, err := w.writeData(); err != nil {
+	w.header = w.cw.n
+	w.progress.start(int64(w.size()))
+	if err := w.writeData(); err != nil {
 		return err
 	}
+	w.progress.finish()
 	w.w.Flush()
 	w.closed = true
 	return nil
@@ -56,59 +175,204 @@ func (w *Writer) Close() error {
 
 // File Format: Header followed by compressed data
 // Header:
-//	- 4 bytes (uint32): the number of bytes in the original file
-//	- 4 bytes (uint32): the size of the alphabet
+//	- 4 bytes (uint32): the number of bytes in the original file, or the
+//	  number of symbols for files written by a SymbolWriter
+//	- 4 bytes (uint32): the size of the alphabet in the low 24 bits and the
+//	  header flags in the high 8 bits. Files without flags use the original
+//	  format, where every symbol is a byte.
+//	- With flagCRC, 4 bytes (uint32): the CRC-32 (IEEE) of the original
+//	  file, or of the symbols as 2 byte (uint16) values for files written by
+//	  a SymbolWriter
+//	- With flagName, 2 bytes (uint16): the length of the name of the
+//	  original file, followed by the name itself
+//	- With flagDict, 4 bytes (uint32): the ID of the preset codebook, which
+//	  takes the place of the table below, and the alphabet size is zero
+//	- For backends other than Huffman coding, the frequency table described
+//	  in arith.go takes the place of the table below
 //	- For each symbol in the alphabet (sorted by symbol value):
-//		- 1 byte: the symbol itself
+//		- 1 byte: the symbol itself, or 2 bytes (uint16) with flagWide
 //		- 1 byte: the number of bits in its codeword
 //		- 0 or more bytes: the codeword, padding to the right with 0 bits
 // Compressed Data:
-//	- 1 or more bytes: raw bytes padded to the right with 0 bits
+//	- 1 or more bytes: raw bytes padded to the right with 0 bits, coded by
+//	  the backend in the header flags
 // All multi-byte values are in little endian.
 
+func (w *Writer) flags() uint32 {
+	var flags uint32
+	if w.wide {
+		flags |= flagWide
+	} else if w.opts.rle {
+		flags |= flagRLE | flagWide
+	}
+	if w.dict != nil {
+		flags |= flagDict
+	}
+	if w.opts.checksum {
+		flags |= flagCRC
+	}
+	if w.opts.name != "" {
+		flags |= flagName
+	}
+	flags |= uint32(w.backend()) << backendShift
+	return flags
+}
+
+func (w *Writer) backend() Backend {
+	if w.dict != nil {
+		return Huffman
+	}
+	return w.opts.backend
+}
+
+// size returns the number of bytes or symbols in the original file.
+func (w *Writer) size() int {
+	if w.wide {
+		return len(w.syms)
+	}
+	return len(w.buf)
+}
+
 func (w *Writer) writeHeader() error {
+	flags := w.flags()
 	// The number of bytes in the original file
-	if err := binary.Write(w.w, binary.LittleEndian, uint32(len(w.buf))); err != nil {
+	if err := binary.Write(w.w, binary.LittleEndian, uint32(w.size())); err != nil {
 		return err
 	}
-	// The size of the alphabet
-	if err := binary.Write(w.w, binary.LittleEndian, uint32(len(w.freqs))); err != nil {
+	// The size of the alphabet and the flags
+	var alphabetSize int
+	switch {
+	case flags&flagDict != 0:
+		alphabetSize = 0
+	case w.table != nil:
+		alphabetSize = len(w.table.syms)
+	default:
+		alphabetSize = w.cb.Len()
+	}
+	if err := binary.Write(w.w, binary.LittleEndian, uint32(alphabetSize)|flags<<flagsShift); err != nil {
 		return err
 	}
-	for i := 0; i <= 0xff; i++ {
-		code, ok := w.codes[byte(i)]
-		if !ok {
-			continue
+	if flags&flagCRC != 0 {
+		if err := binary.Write(w.w, binary.LittleEndian, w.checksum()); err != nil {
+			return err
 		}
-		// The symbol itself
-		if err := binary.Write(w.w, binary.LittleEndian, byte(i)); err != nil {
+	}
+	if flags&flagName != 0 {
+		if err := writeName(w.w, w.opts.name); err != nil {
 			return err
 		}
-		// The number of bits in its codeword
-		if err := binary.Write(w.w, binary.LittleEndian, byte(len(code))); err != nil {
+	}
+	switch {
+	case flags&flagDict != 0:
+		// The ID of the preset codebook
+		return binary.Write(w.w, binary.LittleEndian, w.dict.ID())
+	case w.table != nil:
+		return w.table.writeTo(w.w, flags&flagWide != 0)
+	}
+	return w.cb.writeTable(w.w, flags&flagWide != 0)
+}
+
+// checksum returns the CRC-32 of the original data.
+func (w *Writer) checksum() uint32 {
+	if w.wide {
+		return updateSymbolCRC(0, w.syms)
+	}
+	return crc32.ChecksumIEEE(w.buf)
+}
+
+// updateSymbolCRC returns the result of adding the symbols to crc, as 2 byte
+// little endian values.
+func updateSymbolCRC(crc uint32, syms []uint16) uint32 {
+	var buf [512]byte
+	for len(syms) > 0 {
+		n := len(syms)
+		if n > len(buf)/2 {
+			n = len(buf) / 2
+		}
+		for i, sym := range syms[:n] {
+			binary.LittleEndian.PutUint16(buf[2*i:], sym)
+		}
+		crc = crc32.Update(crc, crc32.IEEETable, buf[:2*n])
+		syms = syms[n:]
+	}
+	return crc
+}
+
+func (w *Writer) writeData() error {
+	switch w.backend() {
+	case Arithmetic:
+		e := newArithEncoder(w.w, w.table)
+		if err := w.eachSymbol(e.encode); err != nil {
 			return err
 		}
-		// The codeword, padded on the right with 0 bits. Note that
-		// it's legal to have an empty codeword, but it only happens
-		// when the alphabet has a single symbol.
-		if _, err := w.w.WriteBitString(code); err != nil {
+		return e.finish()
+	case TANS:
+		return newTANSEncoder(w.table).encode(w.w, w.eachSymbolReverse)
+	}
+	return w.eachSymbol(func(sym uint16) error {
+		_, err := w.w.WriteBitString(w.cb.codes[sym])
+		return err
+	})
+}
+
+// eachSymbol calls fn on each of the symbols to be compressed, in order.
+func (w *Writer) eachSymbol(fn func(sym uint16) error) error {
+	if w.syms != nil {
+		for _, sym := range w.syms {
+			if err := w.step(sym); err != nil {
+				return err
+			}
+			if err := fn(sym); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, b := range w.buf {
+		if err := w.step(uint16(b)); err != nil {
 			return err
 		}
-		if err := w.w.Flush(); err != nil {
+		if err := fn(uint16(b)); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func (w *Writer) writeData() (int, error) {
-	ntotal := 0
-	for i := range w.buf {
-		_, err := w.w.WriteBitString(w.codes[w.buf[i]])
-		if err != nil {
-			return ntotal, err
+// eachSymbolReverse is like eachSymbol, but goes through the symbols in
+// reverse order.
+func (w *Writer) eachSymbolReverse(fn func(sym uint16) error) error {
+	if w.syms != nil {
+		for i := len(w.syms) - 1; i >= 0; i-- {
+			if err := w.step(w.syms[i]); err != nil {
+				return err
+			}
+			if err := fn(w.syms[i]); err != nil {
+				return err
+			}
 		}
-		ntotal++
+		return nil
+	}
+	for i := len(w.buf) - 1; i >= 0; i-- {
+		if err := w.step(uint16(w.buf[i])); err != nil {
+			return err
+		}
+		if err := fn(uint16(w.buf[i])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// step is called before each symbol is compressed. It checks for
+// cancellation and reports progress.
+func (w *Writer) step(sym uint16) error {
+	n := int64(1)
+	if sym > 0xff && !w.wide {
+		// A run-length escape stands for a run of bytes
+		run, _ := runLength(sym)
+		n = int64(run)
 	}
-	return ntotal, nil
+	w.progress.add(n)
+	return w.cancel.step()
 }
@@ -5,6 +5,7 @@ import (
 	"io"
 	"math/rand"
 	"testing"
+	"testing/iotest"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -57,8 +58,9 @@ func TestSimpleCompress(t *testing.T) {
 	// Size of alphabet
 	assert.Equal(t, []byte{0x08, 0x00, 0x00, 0x00}, bytes[4:8])
 
-	// Since there are symbols with the same frequency, the code is going
-	// to be ambiguous. Just test that the symbols are there
+	// The codes depend on how ties between symbols with the same frequency
+	// are broken, see TestBuildCodeMapTies. Just test that the symbols
+	// are there
 	var sortedAlphabet []byte
 	for i := 0x00; i <= 0xff; i++ {
 		if _, ok := freqs[byte(i)]; !ok {
@@ -100,3 +102,121 @@ func TestCompressRandom(t *testing.T) {
 		assert.Equal(t, randBytes, decompressBuf.Bytes())
 	}
 }
+
+func roundTrip(t *testing.T, data []byte, opts ...Option) []byte {
+	compressBuf := new(bytes.Buffer)
+	writer := NewWriter(compressBuf, opts...)
+	if _, err := writer.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := NewReader(bytes.NewReader(compressBuf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	decompressBuf := new(bytes.Buffer)
+	if _, err := io.Copy(decompressBuf, reader); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, decompressBuf.Bytes()) {
+		t.Errorf("round trip of %d bytes doesn't match the input", len(data))
+	}
+	return compressBuf.Bytes()
+}
+
+func TestCompressRLE(t *testing.T) {
+	roundTrip(t, nil, WithRLE())
+	roundTrip(t, []byte("X"), WithRLE())
+	roundTrip(t, []byte("XXXXXXXXXX"), WithRLE())
+	roundTrip(t, []byte("abbcccddddeeeeeffffff"), WithRLE())
+
+	// Runs of every length up to a few powers of two
+	for n := 1; n < 300; n++ {
+		data := append(bytes.Repeat([]byte{'a'}, n), 'b', 'c')
+		data = append(data, bytes.Repeat([]byte{'c'}, n)...)
+		roundTrip(t, data, WithRLE())
+	}
+}
+
+func TestCompressRLERandom(t *testing.T) {
+	for i := 0; i < 200; i++ {
+		// Random data with random runs in it
+		var data []byte
+		for len(data) < i*10 {
+			data = append(data, bytes.Repeat(genRandBytes(1), rand.Intn(20)+1)...)
+		}
+		roundTrip(t, data, WithRLE())
+	}
+}
+
+func TestCompressRLEZeros(t *testing.T) {
+	data := make([]byte, 1<<20)
+	data[len(data)/2] = 0x01
+	compressed := roundTrip(t, data, WithRLE())
+	if len(compressed) > 128 {
+		t.Errorf("len(compressed) == %d; want at most 128", len(compressed))
+	}
+}
+
+func TestDeterministicCompress(t *testing.T) {
+	// Lots of symbols with the same frequency
+	data := []byte("the quick brown fox jumps over the lazy dog")
+	var want []byte
+	for i := 0; i < 100; i++ {
+		buf := new(bytes.Buffer)
+		w := NewWriter(buf)
+		w.Write(data)
+		w.Close()
+		if want == nil {
+			want = buf.Bytes()
+		} else if !bytes.Equal(want, buf.Bytes()) {
+			t.Fatalf("compression %d gave different output", i)
+		}
+	}
+}
+
+func TestWriterInterfaces(t *testing.T) {
+	var _ io.ReaderFrom = (*Writer)(nil)
+	var _ interface {
+		WriteString(s string) (int, error)
+	} = (*Writer)(nil)
+	var _ io.ByteWriter = (*Writer)(nil)
+
+	data := genRandBytes(10000)
+	want := roundTrip(t, data)
+
+	// ReadFrom with short reads
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf)
+	n, err := w.ReadFrom(iotest.OneByteReader(bytes.NewReader(data)))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(data)), n)
+	assert.NoError(t, w.Close())
+	assert.Equal(t, want, buf.Bytes())
+
+	// WriteString and WriteByte
+	buf = new(bytes.Buffer)
+	w = NewWriter(buf)
+	w.WriteString(string(data[:5000]))
+	for _, b := range data[5000:] {
+		assert.NoError(t, w.WriteByte(b))
+	}
+	assert.NoError(t, w.Close())
+	assert.Equal(t, want, buf.Bytes())
+}
+
+func TestCompressChecksum(t *testing.T) {
+	data := []byte("the quick brown fox jumps over the lazy dog")
+	compressed := roundTrip(t, data, WithChecksum())
+	assert.Equal(t, byte(flagCRC), compressed[7])
+	// The checksum follows the flags, in little endian
+	assert.Equal(t, []byte{0x14, 0x51, 0x0c, 0xce}, compressed[8:12])
+
+	roundTrip(t, nil, WithChecksum())
+	for _, backend := range []Backend{Huffman, Arithmetic, TANS} {
+		roundTrip(t, genRandBytes(5000), WithChecksum(), WithBackend(backend))
+		roundTrip(t, make([]byte, 5000), WithChecksum(), WithBackend(backend), WithRLE())
+	}
+}
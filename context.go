@@ -0,0 +1,73 @@
+package hzip
+
+import (
+	"context"
+	"io"
+)
+
+// cancelInterval is the number of symbols that are coded between checks for
+// cancellation, which keeps the cost of checking negligible while still
+// stopping within a few milliseconds.
+const cancelInterval = 1 << 14
+
+// WithContext makes the Writer and the Reader stop with ctx.Err() once ctx is
+// done. The context is checked every few thousand symbols while compressing
+// in Close and while decompressing in Read, so even large inputs can be
+// cancelled promptly. The output of a Writer that's cancelled in Close is
+// incomplete and should be thrown away.
+func WithContext(ctx context.Context) Option {
+	return func(o *options) {
+		o.ctx = ctx
+	}
+}
+
+// A canceler checks a context for cancellation every cancelInterval steps.
+// The zero value never cancels.
+type canceler struct {
+	ctx  context.Context
+	left int // steps until the next check
+}
+
+// err returns the context's error right away.
+func (c *canceler) err() error {
+	if c.ctx == nil {
+		return nil
+	}
+	return c.ctx.Err()
+}
+
+// step counts one step, and returns the context's error if it's time to
+// check it.
+func (c *canceler) step() error {
+	if c.ctx == nil {
+		return nil
+	}
+	if c.left > 0 {
+		c.left--
+		return nil
+	}
+	c.left = cancelInterval
+	return c.ctx.Err()
+}
+
+// CompressContext compresses everything read from src until io.EOF and writes
+// it to dst, stopping early if ctx is done. It returns the number of bytes
+// read from src.
+func CompressContext(ctx context.Context, dst io.Writer, src io.Reader, opts ...Option) (int64, error) {
+	w := NewWriter(dst, append(opts[:len(opts):len(opts)], WithContext(ctx))...)
+	n, err := w.ReadFrom(src)
+	if err != nil {
+		return n, err
+	}
+	return n, w.Close()
+}
+
+// DecompressContext decompresses src and writes the data to dst, stopping
+// early if ctx is done. It returns the number of bytes written to dst.
+func DecompressContext(ctx context.Context, dst io.Writer, src io.Reader, opts ...Option) (int64, error) {
+	r, err := NewReader(src, append(opts[:len(opts):len(opts)], WithContext(ctx))...)
+	if err != nil {
+		return 0, err
+	}
+	return io.Copy(dst, r)
+}
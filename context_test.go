@@ -0,0 +1,78 @@
+package hzip
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompressContext(t *testing.T) {
+	data := genRandBytes(100000)
+	for _, backend := range []Backend{Huffman, Arithmetic, TANS} {
+		compressed := new(bytes.Buffer)
+		n, err := CompressContext(context.Background(), compressed, bytes.NewReader(data), WithBackend(backend))
+		assert.NoError(t, err)
+		assert.Equal(t, int64(len(data)), n)
+
+		decompressed := new(bytes.Buffer)
+		n, err = DecompressContext(context.Background(), decompressed, compressed)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(len(data)), n)
+		assert.Equal(t, data, decompressed.Bytes())
+	}
+}
+
+func TestCompressContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	data := genRandBytes(100000)
+
+	_, err := CompressContext(ctx, new(bytes.Buffer), bytes.NewReader(data))
+	assert.Equal(t, context.Canceled, err)
+
+	w := NewWriter(new(bytes.Buffer), WithContext(ctx))
+	w.Write(data)
+	assert.Equal(t, context.Canceled, w.Close())
+
+	compressed := roundTrip(t, data)
+	_, err = DecompressContext(ctx, new(bytes.Buffer), bytes.NewReader(compressed))
+	assert.Equal(t, context.Canceled, err)
+}
+
+// cancelWriter cancels a context on the first write.
+type cancelWriter struct {
+	cancel context.CancelFunc
+}
+
+func (w *cancelWriter) Write(p []byte) (int, error) {
+	w.cancel()
+	return len(p), nil
+}
+
+func TestDecompressContextCancelledWhileReading(t *testing.T) {
+	data := genRandBytes(1 << 20)
+	compressed := roundTrip(t, data, WithBackend(TANS))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dst := &cancelWriter{cancel: cancel}
+	n, err := DecompressContext(ctx, dst, bytes.NewReader(compressed))
+	assert.Equal(t, context.Canceled, err)
+	assert.True(t, n < int64(len(data)), "n == %d; want less than %d", n, len(data))
+}
+
+func TestCompressContextOptions(t *testing.T) {
+	// The caller's options must not be overwritten, even if there's room
+	// for more of them
+	opts := make([]Option, 1, 2)
+	opts[0] = WithRLE()
+	compressed := new(bytes.Buffer)
+	_, err := CompressContext(context.Background(), compressed, bytes.NewReader([]byte("hello")), opts...)
+	assert.NoError(t, err)
+	assert.Nil(t, opts[:2][1])
+	_, err = DecompressContext(context.Background(), new(bytes.Buffer), compressed, opts...)
+	assert.NoError(t, err)
+	assert.Nil(t, opts[:2][1])
+}
@@ -2,59 +2,287 @@ package hzip
 
 import (
 	"encoding/binary"
+	"errors"
+	"hash/crc32"
 	"io"
+	"io/ioutil"
+)
+
+var (
+	errFlags   = errors.New("hzip: unsupported header flags")
+	errSymbol  = errors.New("hzip: invalid symbol")
+	errRunData = errors.New("hzip: run-length escape without a preceding byte")
+	errCRC     = errors.New("hzip: checksum mismatch")
 )
 
 type Reader struct {
-	r        *bitReader
-	nRead    uint32          // number of symbols read
-	fileSize uint32          // size of the decompressed file
-	symbols  map[string]byte // map from code to symbol
-	mem      []byte          // small slice of memory to avoid memory allocation in calls to Read
+	r        *BitReader
+	nRead    uint32    // number of bytes or symbols read
+	fileSize uint32    // size of the decompressed file
+	flags    uint32    // header flags
+	alphabet int       // size of the alphabet
+	name     string    // name of the original file, with flagName
+	cb       *Codebook // codes for each symbol
+	dec      decoder   // decodes symbols with the backend in the header
+	dict     *Codebook // preset codebook, if any
+	last     byte      // last byte read, repeated by run-length escapes
+	repeat   uint64    // number of pending repeats of last
+	checksum uint32    // checksum from the header, with flagCRC
+	crc      uint32    // checksum of the data read so far
+	cancel   canceler
+	progress progress
 }
 
 // NewReader returns an io.Reader that reads from the given io.Reader and
 // decompresses it using the Huffman coding algorithm.
-func NewReader(r io.Reader) (*Reader, error) {
+func NewReader(r io.Reader, opts ...Option) (*Reader, error) {
+	return newReader(r, nil, opts)
+}
+
+func newReader(r io.Reader, dict *Codebook, opts []Option) (*Reader, error) {
+	o := newOptions(opts)
 	hr := &Reader{
-		r:   newBitReader(r),
-		mem: make([]byte, 1),
+		r:        NewBitReader(r),
+		dict:     dict,
+		cancel:   canceler{ctx: o.ctx},
+		progress: progress{fn: o.progress},
 	}
 	err := hr.readHeader()
 	if err == io.EOF {
 		err = io.ErrUnexpectedEOF
 	}
+	if err == nil {
+		hr.progress.start(int64(hr.fileSize))
+	}
 	return hr, err
 }
 
 func (r *Reader) Read(p []byte) (int, error) {
+	n, err := r.read(p)
+	return r.account(p, n, err)
+}
+
+// account reports progress and updates the checksum for the n bytes that were
+// read into p, and checks the checksum at the end of the data.
+func (r *Reader) account(p []byte, n int, err error) (int, error) {
+	r.progress.add(int64(n))
+	if err == io.EOF {
+		r.progress.finish()
+	}
+	if r.flags&flagCRC != 0 {
+		r.crc = crc32.Update(r.crc, crc32.IEEETable, p[:n])
+		if err == io.EOF {
+			err = r.checkCRC()
+		}
+	}
+	return n, err
+}
+
+// checkCRC returns io.EOF if the checksum of the data matches the one in the
+// header, and errCRC otherwise.
+func (r *Reader) checkCRC() error {
+	if r.crc != r.checksum {
+		return errCRC
+	}
+	return io.EOF
+}
+
+func (r *Reader) read(p []byte) (int, error) {
 	n := 0
-	for i := 0; i < len(p); i++ {
+	for n < len(p) {
 		if r.nRead == r.fileSize {
-			// Slurp up any remaining padding bytes
-			var err error
-			for err != io.EOF {
-				_, err = r.r.ReadBit()
-			}
+			r.discardPadding()
 			return n, io.EOF
 		}
-		// Read one bit at a time until there's a code match
-		code := ""
+		if r.repeat > 0 {
+			// Copy as much of the run as fits in one go
+			k := uint64(len(p) - n)
+			if k > r.repeat {
+				k = r.repeat
+			}
+			if left := uint64(r.fileSize - r.nRead); k > left {
+				k = left
+			}
+			for i := range p[n : n+int(k)] {
+				p[n+i] = r.last
+			}
+			r.repeat -= k
+			r.nRead += uint32(k)
+			n += int(k)
+			continue
+		}
+		if err := r.readSymbol(); err != nil {
+			return n, err
+		}
+		if r.repeat == 0 {
+			p[n] = r.last
+			r.nRead++
+			n++
+		}
+	}
+	return n, nil
+}
+
+// ReadByte reads and returns the next byte.
+func (r *Reader) ReadByte() (byte, error) {
+	var p [1]byte
+	n, err := r.Read(p[:])
+	if n == 1 {
+		return p[0], nil
+	}
+	return 0, err
+}
+
+// WriteTo writes the decompressed data to w until there's no more data or an
+// error occurs. It returns the number of bytes written. Unlike Read, it
+// decodes Huffman coded bytes in bulk, straight into its buffer.
+func (r *Reader) WriteTo(w io.Writer) (int64, error) {
+	if rf, ok := w.(io.ReaderFrom); ok {
+		// Let w have the data decoded straight into its own buffer
+		return rf.ReadFrom(bulkReader{r})
+	}
+	buf := make([]byte, 32*1024)
+	var total int64
+	for {
+		n, err := bulkReader{r}.Read(buf)
+		if n > 0 {
+			m, werr := w.Write(buf[:n])
+			total += int64(m)
+			if werr != nil {
+				return total, werr
+			}
+		}
+		if err == io.EOF {
+			return total, nil
+		}
+		if err != nil {
+			return total, err
+		}
+	}
+}
+
+// bulkReader is an io.Reader that reads from a Reader with readBulk.
+type bulkReader struct {
+	r *Reader
+}
+
+func (b bulkReader) Read(p []byte) (int, error) {
+	n, err := b.r.readBulk(p)
+	return b.r.account(p, n, err)
+}
+
+// readBulk is like read, but decodes a whole buffer at a time for data that's
+// made up of Huffman coded bytes. Cancellation is only checked once per call.
+func (r *Reader) readBulk(p []byte) (int, error) {
+	if r.cb == nil || r.dec != decoder(r.cb) || r.flags&(flagRLE|flagWide) != 0 {
+		return r.read(p)
+	}
+	if err := r.cancel.err(); err != nil {
+		return 0, err
+	}
+	if left := r.fileSize - r.nRead; uint64(len(p)) > uint64(left) {
+		p = p[:left]
+	}
+	n, err := decodeBytes(r.cb, r.r, p)
+	r.nRead += uint32(n)
+	if err == nil && r.nRead == r.fileSize {
+		r.discardPadding()
+		err = io.EOF
+	}
+	return n, err
+}
+
+// decodeBytes decodes len(p) bytes coded with cb into p, walking the decoding
+// trie with bits taken straight from the BitReader's buffer.
+func decodeBytes(cb *Codebook, br *BitReader, p []byte) (int, error) {
+	if sym, ok := cb.symbols[""]; ok {
+		// The only symbol takes no bits at all
+		for i := range p {
+			p[i] = byte(sym)
+		}
+		return len(p), nil
+	}
+	trie := cb.decodeTrie()
+	buf, mask := br.buf, br.mask
+	defer func() { br.buf, br.mask = buf, mask }()
+	for i := range p {
+		node := int32(0)
 		for {
-			if _, ok := r.symbols[code]; ok {
+			if mask == 0 {
+				if _, err := io.ReadFull(br.r, br.mem); err == io.EOF {
+					return i, io.ErrUnexpectedEOF
+				} else if err != nil {
+					return i, err
+				}
+				buf, mask = br.mem[0], 0x80
+			}
+			bit := 0
+			if buf&mask != 0 {
+				bit = 1
+			}
+			mask >>= 1
+			next := trie[node][bit]
+			if next < 0 {
+				p[i] = byte(^next)
 				break
 			}
-			bit, err := r.r.ReadBit()
-			if err == io.EOF {
-				return n, io.ErrUnexpectedEOF
+			if next == 0 {
+				// No code starts like this, so like Decode, read on
+				// to the end of the data without a match
+				buf, mask = 0, 0
+				if _, err := io.Copy(ioutil.Discard, br.r); err != nil {
+					return i, err
+				}
+				return i, io.ErrUnexpectedEOF
 			}
-			code += string(bit)
+			node = next
 		}
-		p[i] = r.symbols[code]
-		r.nRead++
-		n++
 	}
-	return n, nil
+	return len(p), nil
+}
+
+// discardPadding slurps up any remaining padding bytes.
+func (r *Reader) discardPadding() {
+	var err error
+	for err != io.EOF {
+		_, err = r.r.ReadBit()
+	}
+}
+
+// A decoder decodes symbols from a BitReader. Codebook is the decoder for
+// Huffman coding.
+type decoder interface {
+	Decode(r *BitReader) (uint16, error)
+}
+
+// decode reads and decodes the next symbol.
+func (r *Reader) decode() (uint16, error) {
+	if err := r.cancel.step(); err != nil {
+		return 0, err
+	}
+	return r.dec.Decode(r.r)
+}
+
+// readSymbol decodes the next symbol and either stores it in r.last if it's a
+// byte, or adds to r.repeat if it's a run-length escape.
+func (r *Reader) readSymbol() error {
+	sym, err := r.decode()
+	if err != nil {
+		return err
+	}
+	if sym <= 0xff {
+		r.last = byte(sym)
+		return nil
+	}
+	n, ok := runLength(sym)
+	if !ok || r.flags&flagRLE == 0 {
+		return errSymbol
+	}
+	if r.nRead == 0 {
+		return errRunData
+	}
+	r.repeat += n
+	return nil
 }
 
 // See compress.go for documentation about the header format.
@@ -64,37 +292,58 @@ func (r *Reader) readHeader() error {
 		return err
 	}
 
-	// Alphabet size
+	// Alphabet size and flags
 	var alphabetSize uint32
 	if err := binary.Read(r.r, binary.LittleEndian, &alphabetSize); err != nil {
 		return err
 	}
-	r.symbols = make(map[string]byte)
-	for i := uint32(0); i < alphabetSize; i++ {
-		// Symbol
-		if _, err := r.r.Read(r.mem[:1]); err != nil {
+	r.flags = alphabetSize >> flagsShift
+	alphabetSize &= alphabetSizeMask
+	if r.flags&^knownFlags != 0 {
+		return errFlags
+	}
+	r.alphabet = int(alphabetSize)
+	if r.flags&flagCRC != 0 {
+		if err := binary.Read(r.r, binary.LittleEndian, &r.checksum); err != nil {
 			return err
 		}
-		symbol := r.mem[0]
-
-		// Number of bits in code
-		if _, err := r.r.Read(r.mem[:1]); err != nil {
+	}
+	if r.flags&flagName != 0 {
+		name, err := readName(r.r)
+		if err != nil {
 			return err
 		}
-		codeLen := r.mem[0]
-
-		// The code itself
-		var codeBits []byte
-		for k := byte(0); k < codeLen; k++ {
-			bit, err := r.r.ReadBit()
-			if err != nil {
-				return err
-			}
-			codeBits = append(codeBits, bit)
+		r.name = name
+	}
+	if r.flags&flagDict != 0 {
+		if err := r.readDictID(); err != nil {
+			return err
+		}
+		r.dec = r.cb
+		return nil
+	}
+	switch Backend(r.flags & backendMask >> backendShift) {
+	case Huffman:
+		cb, err := readTable(r.r, alphabetSize, r.flags&flagWide != 0)
+		if err != nil {
+			return err
+		}
+		r.cb = cb
+		r.dec = cb
+	case Arithmetic:
+		t, err := readFreqTable(r.r, alphabetSize, r.flags&flagWide != 0)
+		if err != nil {
+			return err
+		}
+		r.dec = newArithDecoder(t)
+	case TANS:
+		t, err := readFreqTable(r.r, alphabetSize, r.flags&flagWide != 0)
+		if err != nil {
+			return err
 		}
-		r.symbols[string(codeBits)] = symbol
-		// Get rid of extra padding at the end, if any
-		r.r.Reset()
+		r.dec = newTANSDecoder(t)
+	default:
+		return errFlags
 	}
 	return nil
 }
@@ -8,6 +8,7 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"testing/iotest"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -91,3 +92,141 @@ func TestMalformedHeader(t *testing.T) {
 	mangled = append([]byte(nil), 0xa, 0x00, 0x00, 0x00)
 	assert.Equal(t, io.ErrUnexpectedEOF, tryDecompress(t, mangled))
 }
+
+func TestMalformedRLE(t *testing.T) {
+	// A run-length escape as the first symbol has nothing to repeat
+	data := []byte{
+		0x01, 0x00, 0x00, 0x00, // original file size
+		0x01, 0x00, 0x00, flagRLE | flagWide, // alphabet size and flags
+		0x00, 0x01, 0x00, // escape symbol with an empty codeword
+	}
+	assert.Equal(t, errRunData, tryDecompress(t, data))
+
+	// Unknown flags
+	data = []byte{
+		0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x80,
+	}
+	assert.Equal(t, errFlags, tryDecompress(t, data))
+}
+
+func TestReaderInterfaces(t *testing.T) {
+	var _ io.WriterTo = (*Reader)(nil)
+	var _ io.ByteReader = (*Reader)(nil)
+
+	data := []byte("abbcccddddeeeeeffffff")
+	data = append(data, make([]byte, 100000)...)
+	for _, opts := range [][]Option{nil, {WithRLE()}} {
+		compressed := roundTrip(t, data, opts...)
+
+		// ReadByte
+		r, err := NewReader(bytes.NewReader(compressed))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []byte
+		for {
+			b, err := r.ReadByte()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, b)
+		}
+		assert.Equal(t, data, got)
+
+		// WriteTo a writer that isn't an io.ReaderFrom
+		r, err = NewReader(bytes.NewReader(compressed))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out bytes.Buffer
+		n, err := r.WriteTo(struct{ io.Writer }{&out})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(len(data)), n)
+		assert.Equal(t, data, out.Bytes())
+
+		// Short reads that stop in the middle of runs
+		r, err = NewReader(bytes.NewReader(compressed))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err = ioutil.ReadAll(iotest.HalfReader(r))
+		assert.NoError(t, err)
+		assert.Equal(t, data, got)
+	}
+}
+
+func TestChecksumMismatch(t *testing.T) {
+	data := genRandBytes(1000)
+	for _, backend := range []Backend{Huffman, Arithmetic, TANS} {
+		buf := new(bytes.Buffer)
+		w := NewWriter(buf, WithChecksum(), WithBackend(backend))
+		w.Write(data)
+		w.Close()
+		compressed := buf.Bytes()
+
+		// Corrupt the checksum itself, which leaves the data intact
+		compressed[8] ^= 0xff
+		r, err := NewReader(bytes.NewReader(compressed))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadAll(r)
+		assert.Equal(t, errCRC, err)
+		assert.Equal(t, data, got)
+		_, err = r.Read(make([]byte, 1))
+		assert.Equal(t, errCRC, err)
+
+		// Truncate the data, which arithmetic decoding doesn't notice
+		compressed[8] ^= 0xff
+		err = tryDecompress(t, compressed[:len(compressed)-20])
+		assert.Error(t, err)
+	}
+}
+
+// benchmarkWriteTo decompresses the benchmark data with io.Copy, either
+// through WriteTo or with WriteTo hidden so that only Read is used.
+func benchmarkWriteTo(b *testing.B, hide bool) {
+	data := benchmarkData(b)
+	b.SetBytes(int64(len(data)))
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf)
+	w.Write(data)
+	w.Close()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r, err := NewReader(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			b.Fatal(err)
+		}
+		var src io.Reader = r
+		if hide {
+			src = struct{ io.Reader }{r}
+		}
+		if _, err := io.Copy(struct{ io.Writer }{ioutil.Discard}, src); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecompressWriteTo(b *testing.B) { benchmarkWriteTo(b, false) }
+func BenchmarkDecompressRead(b *testing.B)    { benchmarkWriteTo(b, true) }
+
+func TestWriteToTruncated(t *testing.T) {
+	data := genRandBytes(1000)
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf)
+	w.Write(data)
+	w.Close()
+	compressed := buf.Bytes()
+	r, err := NewReader(bytes.NewReader(compressed[:len(compressed)-10]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sb strings.Builder
+	_, err = r.WriteTo(&sb)
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+	assert.Equal(t, string(data[:sb.Len()]), sb.String())
+}
@@ -0,0 +1,273 @@
+package hzip
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+)
+
+// DEFLATE (RFC 1951) limits on the lengths of codewords
+const (
+	maxLitLenBits  = 15
+	maxCodeLenBits = 7
+	endOfBlock     = 256
+)
+
+// codeLenOrder is the order in which the lengths of the code length
+// codewords are stored in a dynamic block header.
+var codeLenOrder = [...]int{16, 17, 18, 0, 8, 7, 9, 6, 10, 5, 11, 4, 12, 3, 13, 2, 14, 1, 15}
+
+// A DeflateWriter compresses data into a DEFLATE stream, as described in
+// RFC 1951, or into a gzip file, as described in RFC 1952. The data is stored
+// in a single block with dynamic Huffman codes built from the data, and
+// without any LZ77 matches, so the compression is the same as with a Writer.
+// The output can be read by any DEFLATE or gzip decompressor, such as the
+// ones in compress/flate and compress/gzip.
+//
+// Like a Writer, it doesn't write anything until Close is called.
+type DeflateWriter struct {
+	w      io.Writer
+	gzip   bool
+	buf    []byte
+	freqs  map[uint16]int
+	closed bool
+}
+
+// NewDeflateWriter returns a DeflateWriter that writes a raw DEFLATE stream
+// to w.
+func NewDeflateWriter(w io.Writer) *DeflateWriter {
+	return &DeflateWriter{
+		w:     w,
+		freqs: make(map[uint16]int),
+	}
+}
+
+// NewGzipWriter returns a DeflateWriter that writes a gzip file to w.
+func NewGzipWriter(w io.Writer) *DeflateWriter {
+	dw := NewDeflateWriter(w)
+	dw.gzip = true
+	return dw
+}
+
+func (w *DeflateWriter) Write(p []byte) (int, error) {
+	for _, b := range p {
+		w.freqs[uint16(b)]++
+	}
+	w.buf = append(w.buf, p...)
+	return len(p), nil
+}
+
+// Close writes the compressed data to the underlying io.Writer. It does not
+// close the underlying io.Writer.
+func (w *DeflateWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if w.gzip {
+		// Magic number, deflate method, no flags, no modification time,
+		// no extra flags, unknown OS
+		header := []byte{0x1f, 0x8b, 8, 0, 0, 0, 0, 0, 0, 0xff}
+		if _, err := w.w.Write(header); err != nil {
+			return err
+		}
+	}
+	if err := w.writeBlock(); err != nil {
+		return err
+	}
+	if w.gzip {
+		var trailer [8]byte
+		binary.LittleEndian.PutUint32(trailer[:4], crc32.ChecksumIEEE(w.buf))
+		binary.LittleEndian.PutUint32(trailer[4:], uint32(len(w.buf)))
+		if _, err := w.w.Write(trailer[:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeBlock writes all of the data as a single final block with dynamic
+// Huffman codes.
+func (w *DeflateWriter) writeBlock() error {
+	freqs := make(map[uint16]int, len(w.freqs)+1)
+	for sym, freq := range w.freqs {
+		freqs[sym] = freq
+	}
+	freqs[endOfBlock] = 1
+	litLens := limitedLengths(freqs, maxLitLenBits)
+	litCodes, err := NewCodebookFromLengths(litLens)
+	if err != nil {
+		return err
+	}
+
+	// The literal/length code always has at least 257 entries, for the
+	// literals and the end of block code. No lengths are used, so there's
+	// no need for any distance codes, but there has to be at least one.
+	const nlit, ndist = endOfBlock + 1, 1
+	lengths := make([]int, nlit+ndist)
+	for sym, n := range litLens {
+		lengths[sym] = n
+	}
+	lengths[nlit] = 1
+
+	// The code lengths are themselves run-length encoded and Huffman coded
+	clSyms := encodeCodeLengths(lengths)
+	clFreqs := make(map[uint16]int)
+	for _, s := range clSyms {
+		clFreqs[s.sym]++
+	}
+	clLens := limitedLengths(clFreqs, maxCodeLenBits)
+	clCodes, err := NewCodebookFromLengths(clLens)
+	if err != nil {
+		return err
+	}
+	nclen := len(codeLenOrder)
+	for nclen > 4 && clLens[uint16(codeLenOrder[nclen-1])] == 0 {
+		nclen--
+	}
+
+	bw := &lsbWriter{w: w.w}
+	bw.writeBits(1, 1) // final block
+	bw.writeBits(2, 2) // dynamic Huffman codes
+	bw.writeBits(nlit-257, 5)
+	bw.writeBits(ndist-1, 5)
+	bw.writeBits(uint32(nclen-4), 4)
+	for _, sym := range codeLenOrder[:nclen] {
+		bw.writeBits(uint32(clLens[uint16(sym)]), 3)
+	}
+	for _, s := range clSyms {
+		bw.writeCode(clCodes, s.sym)
+		bw.writeBits(s.extra, s.nextra)
+	}
+	for _, b := range w.buf {
+		bw.writeCode(litCodes, uint16(b))
+	}
+	bw.writeCode(litCodes, endOfBlock)
+	return bw.flush()
+}
+
+// limitedLengths returns the lengths of Huffman codewords for the given
+// frequencies, with no codeword longer than limit bits. The codes are optimal
+// unless they have to be limited, in which case the frequencies are halved
+// until the codes fit, which flattens the tree. A single symbol still gets a
+// one bit codeword, since DEFLATE has no empty codewords.
+func limitedLengths(freqs map[uint16]int, limit int) map[uint16]int {
+	for {
+		lengths := NewCodebook(freqs).Lengths()
+		max := 0
+		for sym, n := range lengths {
+			if n == 0 {
+				lengths[sym] = 1
+				n = 1
+			}
+			if n > max {
+				max = n
+			}
+		}
+		if max <= limit {
+			return lengths
+		}
+		halved := make(map[uint16]int, len(freqs))
+		for sym, freq := range freqs {
+			halved[sym] = (freq + 1) / 2
+		}
+		freqs = halved
+	}
+}
+
+// A codeLenSym is a symbol of the code length alphabet, with its extra bits.
+type codeLenSym struct {
+	sym    uint16
+	extra  uint32
+	nextra uint
+}
+
+// encodeCodeLengths run-length encodes a sequence of codeword lengths with
+// the code length alphabet: 0-15 are lengths, 16 repeats the previous length
+// 3-6 times, 17 repeats a zero length 3-10 times and 18 repeats a zero length
+// 11-138 times.
+func encodeCodeLengths(lengths []int) []codeLenSym {
+	var syms []codeLenSym
+	for i := 0; i < len(lengths); {
+		n := lengths[i]
+		run := 1
+		for i+run < len(lengths) && lengths[i+run] == n {
+			run++
+		}
+		i += run
+		if n == 0 {
+			for run >= 11 {
+				k := run
+				if k > 138 {
+					k = 138
+				}
+				syms = append(syms, codeLenSym{18, uint32(k - 11), 7})
+				run -= k
+			}
+			if run >= 3 {
+				syms = append(syms, codeLenSym{17, uint32(run - 3), 3})
+				run = 0
+			}
+		} else {
+			syms = append(syms, codeLenSym{sym: uint16(n)})
+			run--
+			for run >= 3 {
+				k := run
+				if k > 6 {
+					k = 6
+				}
+				syms = append(syms, codeLenSym{16, uint32(k - 3), 2})
+				run -= k
+			}
+		}
+		for ; run > 0; run-- {
+			syms = append(syms, codeLenSym{sym: uint16(n)})
+		}
+	}
+	return syms
+}
+
+// lsbWriter writes bits least significant bit first, which is the order used
+// by DEFLATE for everything but Huffman codewords.
+type lsbWriter struct {
+	w     io.Writer
+	bits  uint64
+	nbits uint
+	out   []byte // whole bytes that haven't been written yet
+	err   error
+}
+
+func (w *lsbWriter) writeBits(v uint32, n uint) {
+	w.bits |= uint64(v) << w.nbits
+	w.nbits += n
+	for w.nbits >= 8 {
+		w.out = append(w.out, byte(w.bits))
+		w.bits >>= 8
+		w.nbits -= 8
+	}
+	if len(w.out) >= 4096 && w.err == nil {
+		_, w.err = w.w.Write(w.out)
+		w.out = w.out[:0]
+	}
+}
+
+// writeCode writes the codeword for sym, starting from its most significant
+// bit.
+func (w *lsbWriter) writeCode(c *Codebook, sym uint16) {
+	code := c.codes[sym]
+	for i := 0; i < len(code); i++ {
+		w.writeBits(uint32(code[i]-'0'), 1)
+	}
+}
+
+// flush writes any remaining bits, padded with zeroes to a whole byte.
+func (w *lsbWriter) flush() error {
+	if w.nbits > 0 {
+		w.writeBits(0, 8-w.nbits)
+	}
+	if len(w.out) > 0 && w.err == nil {
+		_, w.err = w.w.Write(w.out)
+		w.out = w.out[:0]
+	}
+	return w.err
+}
@@ -0,0 +1,102 @@
+package hzip
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func gzipRoundTrip(t *testing.T, data []byte) []byte {
+	buf := new(bytes.Buffer)
+	w := NewGzipWriter(buf)
+	w.Write(data)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r, err := gzip.NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, out) {
+		t.Errorf("gzip round trip of %d bytes doesn't match the input", len(data))
+	}
+	return buf.Bytes()
+}
+
+func TestGzipRoundTrip(t *testing.T) {
+	gzipRoundTrip(t, nil)
+	gzipRoundTrip(t, []byte("X"))
+	gzipRoundTrip(t, []byte("XXXXXXXXXX"))
+	gzipRoundTrip(t, []byte("Hello World\n"))
+	for i := 0; i < 300; i++ {
+		gzipRoundTrip(t, genRandBytes(i*13))
+	}
+}
+
+func TestGzipLongCodes(t *testing.T) {
+	// Fibonacci frequencies give a Huffman tree as deep as possible, which
+	// is deeper than DEFLATE allows
+	var data []byte
+	a, b := 1, 1
+	for sym := 0; sym < 25; sym++ {
+		data = append(data, bytes.Repeat([]byte{byte(sym)}, a)...)
+		a, b = b, a+b
+	}
+	for i := len(data) - 1; i > 0; i-- {
+		j := rand.Intn(i + 1)
+		data[i], data[j] = data[j], data[i]
+	}
+	gzipRoundTrip(t, data)
+}
+
+func TestDeflateRoundTrip(t *testing.T) {
+	data := genRandBytes(10000)
+	buf := new(bytes.Buffer)
+	w := NewDeflateWriter(buf)
+	w.Write(data)
+	w.Close()
+	out := new(bytes.Buffer)
+	_, err := io.Copy(out, flate.NewReader(bytes.NewReader(buf.Bytes())))
+	assert.Nil(t, err)
+	assert.Equal(t, data, out.Bytes())
+}
+
+func TestLimitedLengths(t *testing.T) {
+	freqs := make(map[uint16]int)
+	a, b := 1, 1
+	for sym := uint16(0); sym < 30; sym++ {
+		freqs[sym] = a
+		a, b = b, a+b
+	}
+	lengths := limitedLengths(freqs, maxLitLenBits)
+	// Kraft's inequality has to hold with equality for a complete code
+	sum := 0.0
+	for _, n := range lengths {
+		assert.True(t, n <= maxLitLenBits)
+		sum += 1 / float64(int(1)<<uint(n))
+	}
+	assert.Equal(t, 1.0, sum)
+
+	assert.Equal(t, map[uint16]int{7: 1}, limitedLengths(map[uint16]int{7: 3}, 7))
+}
+
+func TestEncodeCodeLengths(t *testing.T) {
+	lengths := []int{3, 3, 3, 3, 3, 3, 3, 3, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 2, 0, 0}
+	want := []codeLenSym{
+		{3, 0, 0}, {16, 3, 2}, {3, 0, 0},
+		{18, 1, 7},
+		{2, 0, 0},
+		{0, 0, 0}, {0, 0, 0},
+	}
+	assert.Equal(t, want, encodeCodeLengths(lengths))
+}
@@ -0,0 +1,81 @@
+package hzip
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+)
+
+var (
+	errNoDict    = errors.New("hzip: data requires a dictionary")
+	errWrongDict = errors.New("hzip: data was compressed with a different dictionary")
+)
+
+// Train builds a codebook for use as a dictionary with NewWriterDict and
+// NewReaderDict from representative samples of the data that will be
+// compressed. Every byte value gets a codeword, even ones that don't appear in
+// the samples, so the dictionary can compress any data.
+func Train(samples [][]byte) *Codebook {
+	freqs := make(map[uint16]int, 256)
+	for i := 0; i <= 0xff; i++ {
+		freqs[uint16(i)] = 1
+	}
+	for _, sample := range samples {
+		for _, b := range sample {
+			freqs[uint16(b)]++
+		}
+	}
+	return NewCodebook(freqs)
+}
+
+// NewWriterDict is like NewWriter but compresses the data with a preset
+// codebook instead of building one from the data. Only the ID of the codebook
+// is written to the header rather than the whole code table, which makes the
+// output a lot smaller for short messages. The data must be read with
+// NewReaderDict and the same codebook.
+//
+// Close fails if the data contains a symbol that isn't in the codebook. With
+// the WithRLE option, that includes the run-length escapes, so codebooks made
+// by Train can't be used for run-length encoded data.
+func NewWriterDict(w io.Writer, dict *Codebook, opts ...Option) *Writer {
+	hw := NewWriter(w, opts...)
+	hw.dict = dict
+	return hw
+}
+
+// NewReaderDict is like NewReader but can also read data written by
+// NewWriterDict with the same codebook. Data that has its own code table is
+// read as usual.
+func NewReaderDict(r io.Reader, dict *Codebook, opts ...Option) (*Reader, error) {
+	return newReader(r, dict, opts)
+}
+
+// ID returns an identifier for the codebook, which is a checksum of its
+// serialized form. Codebooks with the same codewords have the same ID.
+func (c *Codebook) ID() uint32 {
+	c.idOnce.Do(func() {
+		h := crc32.NewIEEE()
+		c.WriteTo(h)
+		c.id = h.Sum32()
+	})
+	return c.id
+}
+
+// readDictID reads the codebook ID that takes the place of the code table
+// with flagDict, and checks it against the Reader's dictionary.
+func (r *Reader) readDictID() error {
+	var id uint32
+	if err := binary.Read(r.r, binary.LittleEndian, &id); err != nil {
+		return err
+	}
+	if r.dict == nil {
+		return errNoDict
+	}
+	if id != r.dict.ID() {
+		return errWrongDict
+	}
+	r.cb = r.dict
+	r.alphabet = r.dict.Len()
+	return nil
+}
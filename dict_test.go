@@ -0,0 +1,85 @@
+package hzip
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func compressDict(t *testing.T, dict *Codebook, data []byte, opts ...Option) []byte {
+	buf := new(bytes.Buffer)
+	w := NewWriterDict(buf, dict, opts...)
+	w.Write(data)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDictRoundTrip(t *testing.T) {
+	dict := Train([][]byte{
+		[]byte(`{"id": 1, "name": "foo"}`),
+		[]byte(`{"id": 2, "name": "bar"}`),
+	})
+	assert.Equal(t, 256, dict.Len())
+
+	msg := `{"id": 3, "name": "baz"}`
+	data := compressDict(t, dict, []byte(msg))
+	if len(data) >= 12+len(msg) {
+		t.Errorf("len(data) == %d; want less than %d", len(data), 12+len(msg))
+	}
+
+	for _, msg := range []string{"", msg, "\x00\xff unseen bytes"} {
+		data := compressDict(t, dict, []byte(msg))
+		// File size, flags and dictionary ID, followed by the data
+		assert.Equal(t, []byte{0x00, 0x00, 0x00, flagDict}, data[4:8])
+
+		r, err := NewReaderDict(bytes.NewReader(data), dict)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf := new(bytes.Buffer)
+		if _, err := io.Copy(buf, r); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, msg, buf.String())
+	}
+}
+
+func TestDictMismatch(t *testing.T) {
+	dict := Train([][]byte{[]byte("aaaab")})
+	other := Train([][]byte{[]byte("bbbba")})
+	assert.NotEqual(t, dict.ID(), other.ID())
+	assert.Equal(t, dict.ID(), Train([][]byte{[]byte("aaaab")}).ID())
+
+	data := compressDict(t, dict, []byte("hello"))
+	_, err := NewReaderDict(bytes.NewReader(data), other)
+	assert.Equal(t, errWrongDict, err)
+	_, err = NewReader(bytes.NewReader(data))
+	assert.Equal(t, errNoDict, err)
+
+	// Data with its own code table doesn't need the dictionary
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf)
+	io.WriteString(w, "hello")
+	w.Close()
+	r, err := NewReaderDict(bytes.NewReader(buf.Bytes()), dict)
+	assert.Nil(t, err)
+	out := new(bytes.Buffer)
+	io.Copy(out, r)
+	assert.Equal(t, "hello", out.String())
+}
+
+func TestDictMissingSymbol(t *testing.T) {
+	dict := NewCodebook(map[uint16]int{'a': 1, 'b': 1})
+	w := NewWriterDict(new(bytes.Buffer), dict)
+	io.WriteString(w, "abc")
+	assert.NotNil(t, w.Close())
+
+	// Run-length escapes aren't in trained dictionaries
+	w = NewWriterDict(new(bytes.Buffer), Train(nil), WithRLE())
+	io.WriteString(w, "aaaaaaaa")
+	assert.NotNil(t, w.Close())
+}
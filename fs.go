@@ -0,0 +1,468 @@
+package hzip
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+)
+
+var (
+	errIsDir  = errors.New("is a directory")
+	errNotDir = errors.New("not a directory")
+)
+
+// An ArchiveReader is an fs.FS, so that the files in an archive can be used
+// with fs.WalkDir, http.FS, template.ParseFS and so on. Each file is only
+// decompressed as it's read. Directories that aren't in the archive
+// themselves, but have files in them, are added to the file system.
+var (
+	_ fs.ReadDirFS = (*ArchiveReader)(nil)
+	_ fs.StatFS    = (*ArchiveReader)(nil)
+)
+
+// index builds the indexes of the files by name and by directory. Entries
+// beneath a regular file are left out of the file system.
+func (a *ArchiveReader) index() {
+	a.once.Do(func() {
+		a.byName = make(map[string]*ArchiveFile, len(a.File)+1)
+		a.children = make(map[string][]*ArchiveFile)
+		a.byName["."] = &ArchiveFile{ArchiveHeader: ArchiveHeader{Name: ".", Mode: fs.ModeDir | 0555}}
+		// Every entry goes in first, so that the directories that are
+		// added for the files in them never stand in for a real entry
+		for _, f := range a.File {
+			a.byName[f.Name] = f
+		}
+		var files []*ArchiveFile
+		for _, f := range a.File {
+			if a.underFile(f.Name) {
+				delete(a.byName, f.Name)
+			} else {
+				files = append(files, f)
+			}
+		}
+		for _, f := range files {
+			a.add(f)
+		}
+		for _, files := range a.children {
+			sort.Slice(files, func(i, j int) bool {
+				return files[i].Name < files[j].Name
+			})
+		}
+	})
+}
+
+// underFile reports whether any of the parent directories of name is a
+// regular file in the archive.
+func (a *ArchiveReader) underFile(name string) bool {
+	for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+		if f, ok := a.byName[dir]; ok && !f.Mode.IsDir() {
+			return true
+		}
+	}
+	return false
+}
+
+// add adds f, which is already in byName, to the files in its directory, and
+// adds the directory if it's not there yet.
+func (a *ArchiveReader) add(f *ArchiveFile) {
+	dir := path.Dir(f.Name)
+	a.children[dir] = append(a.children[dir], f)
+	if _, ok := a.byName[dir]; !ok {
+		d := &ArchiveFile{ArchiveHeader: ArchiveHeader{Name: dir, Mode: fs.ModeDir | 0555}}
+		a.byName[dir] = d
+		a.add(d)
+	}
+}
+
+// lookup returns the file or directory called name. Names beneath a regular
+// file are invalid.
+func (a *ArchiveReader) lookup(op, name string) (*ArchiveFile, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	a.index()
+	f, ok := a.byName[name]
+	if !ok {
+		err := fs.ErrNotExist
+		if a.underFile(name) {
+			err = fs.ErrInvalid
+		}
+		return nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	return f, nil
+}
+
+// Open opens the named file or directory. Files are decompressed as they're
+// read.
+func (a *ArchiveReader) Open(name string) (fs.File, error) {
+	f, err := a.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if f.Mode.IsDir() {
+		entries, _ := a.ReadDir(name)
+		return &fsDir{name: name, info: f.FileInfo(), entries: entries}, nil
+	}
+	return &archiveFSFile{f: f, name: name}, nil
+}
+
+// Stat returns an fs.FileInfo for the named file or directory.
+func (a *ArchiveReader) Stat(name string) (fs.FileInfo, error) {
+	f, err := a.lookup("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return f.FileInfo(), nil
+}
+
+// ReadDir returns the files in the named directory, sorted by name.
+func (a *ArchiveReader) ReadDir(name string) ([]fs.DirEntry, error) {
+	f, err := a.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !f.Mode.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errNotDir}
+	}
+	files := a.children[name]
+	entries := make([]fs.DirEntry, len(files))
+	for i, f := range files {
+		entries[i] = infoDirEntry{f.FileInfo()}
+	}
+	return entries, nil
+}
+
+// archiveFSFile is an open file from an archive. It's an io.Seeker, so that
+// http.FS can serve it, but seeking backwards starts reading the file again
+// from the beginning.
+type archiveFSFile struct {
+	f      *ArchiveFile
+	name   string
+	r      *Reader
+	err    error
+	pos    int64 // the number of bytes read from r
+	off    int64 // the offset that the next Read starts at
+	closed bool
+}
+
+func (f *archiveFSFile) Stat() (fs.FileInfo, error) {
+	if f.closed {
+		return nil, &fs.PathError{Op: "stat", Path: f.name, Err: fs.ErrClosed}
+	}
+	return f.f.FileInfo(), nil
+}
+
+func (f *archiveFSFile) Read(p []byte) (int, error) {
+	if f.closed {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: fs.ErrClosed}
+	}
+	if f.r == nil && f.err == nil {
+		f.r, f.err = f.f.Open()
+	}
+	if f.err != nil {
+		return 0, f.err
+	}
+	if err := skip(f.r, &f.pos, f.off); err != nil {
+		return 0, err
+	}
+	n, err := f.r.Read(p)
+	f.pos += int64(n)
+	f.off = f.pos
+	return n, err
+}
+
+func (f *archiveFSFile) Seek(offset int64, whence int) (int64, error) {
+	if f.closed {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrClosed}
+	}
+	off, err := seekOffset(f.off, f.f.Size, offset, whence)
+	if err != nil {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: err}
+	}
+	if off < f.pos {
+		f.r, f.err, f.pos = nil, nil, 0
+	}
+	f.off = off
+	return off, nil
+}
+
+func (f *archiveFSFile) Close() error {
+	if f.closed {
+		return &fs.PathError{Op: "close", Path: f.name, Err: fs.ErrClosed}
+	}
+	f.closed = true
+	return nil
+}
+
+// seekOffset returns the offset that seeking to offset from whence moves to,
+// in a file of size bytes that's at off.
+func seekOffset(off, size, offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += off
+	case io.SeekEnd:
+		offset += size
+	default:
+		return 0, fs.ErrInvalid
+	}
+	if offset < 0 {
+		return 0, fs.ErrInvalid
+	}
+	return offset, nil
+}
+
+// skip reads and discards data from r, which is at *pos, until it's at off
+// or at the end of the data.
+func skip(r io.Reader, pos *int64, off int64) error {
+	if *pos >= off {
+		return nil
+	}
+	n, err := io.CopyN(ioutil.Discard, r, off-*pos)
+	*pos += n
+	if err == io.EOF {
+		err = nil
+	}
+	return err
+}
+
+// A DirFS is an fs.FS for a file system with files compressed by hzip, such as
+// a directory of .hz files. The compressed files show up without their .hz
+// suffix, and are decompressed as they're read. Only directories and files
+// with the .hz suffix are in the DirFS.
+type DirFS struct {
+	fsys fs.FS
+}
+
+var (
+	_ fs.ReadDirFS = (*DirFS)(nil)
+	_ fs.StatFS    = (*DirFS)(nil)
+)
+
+// NewDirFS returns a DirFS for the files in fsys, which is often an
+// os.DirFS.
+func NewDirFS(fsys fs.FS) *DirFS {
+	return &DirFS{fsys: fsys}
+}
+
+const dirFSSuffix = ".hz"
+
+// Open opens the named file or directory. Opening a file opens the file with
+// the .hz suffix added to its name.
+func (d *DirFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if fi, err := fs.Stat(d.fsys, name); err == nil && fi.IsDir() {
+		entries, err := d.ReadDir(name)
+		if err != nil {
+			return nil, err
+		}
+		return &fsDir{name: name, info: fi, entries: entries}, nil
+	}
+	f, err := d.fsys.Open(name + dirFSSuffix)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: pathErr(err)}
+	}
+	fi, err := f.Stat()
+	if err == nil && !fi.Mode().IsRegular() {
+		err = fs.ErrNotExist
+	}
+	if err != nil {
+		f.Close()
+		return nil, &fs.PathError{Op: "open", Path: name, Err: pathErr(err)}
+	}
+	return &dirFSFile{fsys: d.fsys, f: f, fi: fi, name: name}, nil
+}
+
+// Stat returns an fs.FileInfo for the named file or directory. The size of a
+// file is read from its header.
+func (d *DirFS) Stat(name string) (fs.FileInfo, error) {
+	f, err := d.Open(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: pathErr(err)}
+	}
+	defer f.Close()
+	return f.Stat()
+}
+
+// ReadDir returns the directories and compressed files in the named
+// directory, sorted by name.
+func (d *DirFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	all, err := fs.ReadDir(d.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	var entries []fs.DirEntry
+	dirs := make(map[string]bool)
+	for _, e := range all {
+		if e.IsDir() {
+			entries = append(entries, e)
+			dirs[e.Name()] = true
+		}
+	}
+	for _, e := range all {
+		base := strings.TrimSuffix(e.Name(), dirFSSuffix)
+		if e.Type().IsRegular() && base != e.Name() && base != "" && !dirs[base] {
+			entries = append(entries, &dirFSEntry{d: d, name: base, path: path.Join(name, base)})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
+
+// pathErr returns the error in an *fs.PathError, so that it can be wrapped in
+// one with the name in the DirFS.
+func pathErr(err error) error {
+	var pe *fs.PathError
+	if errors.As(err, &pe) {
+		return pe.Err
+	}
+	return err
+}
+
+// dirFSEntry is a compressed file in a directory of a DirFS.
+type dirFSEntry struct {
+	d    *DirFS
+	name string
+	path string
+}
+
+func (e *dirFSEntry) Name() string               { return e.name }
+func (e *dirFSEntry) IsDir() bool                { return false }
+func (e *dirFSEntry) Type() fs.FileMode          { return 0 }
+func (e *dirFSEntry) Info() (fs.FileInfo, error) { return e.d.Stat(e.path) }
+
+// dirFSFile is an open compressed file from a DirFS. It's an io.Seeker like
+// archiveFSFile, and seeking backwards opens the compressed file again.
+type dirFSFile struct {
+	fsys fs.FS
+	f    fs.File
+	fi   fs.FileInfo // of the compressed file
+	name string
+	r    *Reader
+	err  error
+	pos  int64 // the number of bytes read from r
+	off  int64 // the offset that the next Read starts at
+}
+
+// reader returns the Reader for the file, reading its header the first time
+// it's called.
+func (f *dirFSFile) reader() (*Reader, error) {
+	if f.r == nil && f.err == nil {
+		f.r, f.err = NewReader(bufio.NewReader(f.f))
+	}
+	return f.r, f.err
+}
+
+func (f *dirFSFile) Stat() (fs.FileInfo, error) {
+	r, err := f.reader()
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: f.name, Err: err}
+	}
+	return dirFSFileInfo{FileInfo: f.fi, name: path.Base(f.name), size: r.Header().Size}, nil
+}
+
+func (f *dirFSFile) Read(p []byte) (int, error) {
+	r, err := f.reader()
+	if err != nil {
+		return 0, err
+	}
+	if err := skip(r, &f.pos, f.off); err != nil {
+		return 0, err
+	}
+	n, err := r.Read(p)
+	f.pos += int64(n)
+	f.off = f.pos
+	return n, err
+}
+
+func (f *dirFSFile) Seek(offset int64, whence int) (int64, error) {
+	r, err := f.reader()
+	if err != nil {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: err}
+	}
+	off, err := seekOffset(f.off, r.Header().Size, offset, whence)
+	if err != nil {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: err}
+	}
+	if off < f.pos {
+		// Start again from the beginning of the compressed file
+		nf, err := f.fsys.Open(f.name + dirFSSuffix)
+		if err != nil {
+			return 0, &fs.PathError{Op: "seek", Path: f.name, Err: pathErr(err)}
+		}
+		f.f.Close()
+		f.f, f.r, f.err, f.pos = nf, nil, nil, 0
+	}
+	f.off = off
+	return off, nil
+}
+
+func (f *dirFSFile) Close() error {
+	return f.f.Close()
+}
+
+// dirFSFileInfo is the fs.FileInfo of the compressed file, with the name and
+// size of the original file.
+type dirFSFileInfo struct {
+	fs.FileInfo
+	name string
+	size int64
+}
+
+func (fi dirFSFileInfo) Name() string { return fi.name }
+func (fi dirFSFileInfo) Size() int64  { return fi.size }
+
+// fsDir is an open directory.
+type fsDir struct {
+	name    string
+	info    fs.FileInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *fsDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *fsDir) Close() error               { return nil }
+
+func (d *fsDir) Read(p []byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: errIsDir}
+}
+
+// ReadDir returns the next n entries in the directory, or all of the rest if
+// n <= 0.
+func (d *fsDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	rest := d.entries[d.offset:]
+	if n <= 0 {
+		d.offset = len(d.entries)
+		return rest, nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(rest) {
+		n = len(rest)
+	}
+	d.offset += n
+	return rest[:n], nil
+}
+
+// infoDirEntry is an fs.DirEntry for an fs.FileInfo.
+type infoDirEntry struct {
+	fi fs.FileInfo
+}
+
+func (e infoDirEntry) Name() string               { return e.fi.Name() }
+func (e infoDirEntry) IsDir() bool                { return e.fi.IsDir() }
+func (e infoDirEntry) Type() fs.FileMode          { return e.fi.Mode().Type() }
+func (e infoDirEntry) Info() (fs.FileInfo, error) { return e.fi, nil }
@@ -0,0 +1,250 @@
+package hzip
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArchiveFS(t *testing.T) {
+	data := writeTestArchive(t)
+	ar, err := NewArchiveReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fstest.TestFS(ar, "docs/hello.txt", "docs/empty", "random.bin"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := fs.ReadFile(ar, "docs/hello.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello World\n", string(got))
+	fi, err := fs.Stat(ar, "docs")
+	if assert.NoError(t, err) {
+		assert.Equal(t, fs.ModeDir|0755, fi.Mode())
+	}
+	_, err = ar.Open("missing")
+	assert.True(t, errors.Is(err, fs.ErrNotExist), "%v", err)
+	_, err = ar.Open("/docs")
+	assert.True(t, errors.Is(err, fs.ErrInvalid), "%v", err)
+}
+
+func TestArchiveFSImplicitDirs(t *testing.T) {
+	buf := new(bytes.Buffer)
+	aw := NewArchiveWriter(buf)
+	for _, name := range []string{"b/c/d.txt", "a.txt", "b/c/e.txt"} {
+		w, err := aw.Create(&ArchiveHeader{Name: name, Mode: 0644})
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(name))
+	}
+	if err := aw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	ar, err := NewArchiveReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fstest.TestFS(ar, "a.txt", "b/c/d.txt", "b/c/e.txt"); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := fs.ReadDir(ar, ".")
+	if assert.NoError(t, err) && assert.Equal(t, 2, len(entries)) {
+		assert.Equal(t, "a.txt", entries[0].Name())
+		assert.Equal(t, "b", entries[1].Name())
+		assert.True(t, entries[1].IsDir())
+	}
+}
+
+func TestArchiveFSFileWithEntriesBeneath(t *testing.T) {
+	// a/b comes before a, which turns out to be a file, and c/d before c,
+	// which is a directory
+	buf := new(bytes.Buffer)
+	aw := NewArchiveWriter(buf)
+	for _, h := range []ArchiveHeader{
+		{Name: "a/b", Mode: 0644},
+		{Name: "a/c/d", Mode: 0644},
+		{Name: "a", Mode: 0644},
+		{Name: "c/d", Mode: 0644},
+		{Name: "c", Mode: fs.ModeDir | 0700},
+	} {
+		h := h
+		w, err := aw.Create(&h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !h.Mode.IsDir() {
+			w.Write([]byte(h.Name))
+		}
+	}
+	if err := aw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	ar, err := NewArchiveReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fstest.TestFS(ar, "a", "c/d"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := fs.ReadFile(ar, "a")
+	assert.NoError(t, err)
+	assert.Equal(t, "a", string(got))
+	for _, name := range []string{"a/b", "a/c", "a/c/d"} {
+		_, err = ar.Open(name)
+		assert.True(t, errors.Is(err, fs.ErrInvalid), "%s: %v", name, err)
+	}
+	fi, err := fs.Stat(ar, "c")
+	if assert.NoError(t, err) {
+		assert.Equal(t, fs.ModeDir|0700, fi.Mode())
+	}
+	entries, err := fs.ReadDir(ar, ".")
+	if assert.NoError(t, err) && assert.Equal(t, 2, len(entries)) {
+		assert.False(t, entries[0].IsDir())
+		assert.Equal(t, fs.ModeDir|0700, mustInfo(t, entries[1]).Mode())
+	}
+}
+
+func mustInfo(t *testing.T, e fs.DirEntry) fs.FileInfo {
+	fi, err := e.Info()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fi
+}
+
+func compressBytes(t *testing.T, data []byte) []byte {
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf)
+	w.Write(data)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDirFS(t *testing.T) {
+	mtime := time.Unix(1000000000, 0)
+	random := genRandBytes(10000)
+	mapFS := fstest.MapFS{
+		"index.html.hz":      {Data: compressBytes(t, []byte("<html></html>")), Mode: 0644, ModTime: mtime},
+		"css/site.css.hz":    {Data: compressBytes(t, []byte("body {}")), Mode: 0600, ModTime: mtime},
+		"css/empty.hz":       {Data: compressBytes(t, nil)},
+		"img/random.bin.hz":  {Data: compressBytes(t, random)},
+		"README":             {Data: []byte("not compressed")},
+		"img/random.bin.tmp": {Data: []byte("not compressed")},
+	}
+	fsys := NewDirFS(mapFS)
+	if err := fstest.TestFS(fsys, "index.html", "css/site.css", "css/empty", "img/random.bin"); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := fs.ReadFile(fsys, "img/random.bin")
+	assert.NoError(t, err)
+	assert.Equal(t, random, got)
+
+	fi, err := fs.Stat(fsys, "css/site.css")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "site.css", fi.Name())
+		assert.Equal(t, int64(len("body {}")), fi.Size())
+		assert.Equal(t, fs.FileMode(0600), fi.Mode())
+		assert.True(t, mtime.Equal(fi.ModTime()))
+	}
+
+	// Only compressed files are in the DirFS
+	_, err = fsys.Open("README")
+	assert.True(t, errors.Is(err, fs.ErrNotExist), "%v", err)
+	_, err = fsys.Open("index.html.hz")
+	assert.True(t, errors.Is(err, fs.ErrNotExist), "%v", err)
+	entries, err := fs.ReadDir(fsys, ".")
+	if assert.NoError(t, err) {
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		assert.Equal(t, []string{"css", "img", "index.html"}, names)
+	}
+}
+
+func TestFSSeek(t *testing.T) {
+	data := writeTestArchive(t)
+	ar, err := NewArchiveReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	random := testArchiveFiles[3].data
+	dirFS := NewDirFS(fstest.MapFS{"random.bin.hz": {Data: compressBytes(t, random)}})
+	for _, fsys := range []fs.FS{ar, dirFS} {
+		f, err := fsys.Open("random.bin")
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, ok := f.(io.ReadSeeker)
+		if !assert.True(t, ok, "%T is not an io.Seeker", f) {
+			continue
+		}
+		buf := make([]byte, 100)
+		for _, seek := range []struct {
+			offset int64
+			whence int
+			want   int64
+		}{
+			{5000, io.SeekStart, 5000},
+			{100, io.SeekCurrent, 5200},
+			{10, io.SeekStart, 10}, // backwards
+			{-100, io.SeekEnd, int64(len(random) - 100)},
+		} {
+			off, err := s.Seek(seek.offset, seek.whence)
+			assert.NoError(t, err)
+			assert.Equal(t, seek.want, off)
+			_, err = io.ReadFull(s, buf)
+			assert.NoError(t, err)
+			assert.Equal(t, random[seek.want:seek.want+100], buf)
+		}
+		// Past the end there's nothing to read
+		_, err = s.Seek(1, io.SeekEnd)
+		assert.NoError(t, err)
+		n, err := s.Read(buf)
+		assert.Equal(t, 0, n)
+		assert.Equal(t, io.EOF, err)
+		_, err = s.Seek(-1, io.SeekStart)
+		assert.True(t, errors.Is(err, fs.ErrInvalid), "%v", err)
+		f.Close()
+
+		// http.FileServer seeks to sniff the content type and to serve
+		// ranges
+		h := http.FileServer(http.FS(fsys))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", "/random.bin", nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, random, rec.Body.Bytes())
+
+		req := httptest.NewRequest("GET", "/random.bin", nil)
+		req.Header.Set("Range", "bytes=1000-1099")
+		rec = httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusPartialContent, rec.Code)
+		assert.Equal(t, random[1000:1100], rec.Body.Bytes())
+	}
+}
+
+func TestDirFSLazy(t *testing.T) {
+	// A corrupt file can still be opened, the error comes from reading it
+	fsys := NewDirFS(fstest.MapFS{"bad.hz": {Data: []byte{0x01}}})
+	f, err := fsys.Open("bad")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	_, err = ioutil.ReadAll(f)
+	assert.Error(t, err)
+}
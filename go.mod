@@ -1,5 +1,7 @@
 module github.com/burakguven/hzip
 
+go 1.16
+
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
@@ -0,0 +1,90 @@
+package hzip
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+)
+
+var (
+	errNameLength = errors.New("hzip: name too long")
+	errTooLarge   = errors.New("hzip: input too large")
+)
+
+// maxSize is the largest number of bytes or symbols that fit in the size
+// field of the header. It's a variable so that tests can lower it.
+var maxSize int64 = math.MaxUint32
+
+// A Header describes a compressed file. It's read from the start of the file
+// by NewReader, without decompressing any of the data.
+type Header struct {
+	// Size is the number of bytes in the original file, or the number of
+	// symbols for files written by a SymbolWriter.
+	Size int64
+	// AlphabetSize is the number of different symbols that were coded.
+	AlphabetSize int
+	// Backend is the entropy coder that the data was compressed with.
+	Backend Backend
+	// RLE reports whether the data was run-length encoded.
+	RLE bool
+	// Symbols reports whether the file was written by a SymbolWriter.
+	Symbols bool
+	// HasChecksum reports whether the header has a checksum of the data,
+	// which is in Checksum.
+	HasChecksum bool
+	Checksum    uint32
+	// Name is the name of the original file, if it was given to the
+	// Writer with WithName.
+	Name string
+	// MaxCodeLength is the number of bits in the longest codeword, for
+	// Huffman coding. It's zero for the other backends.
+	MaxCodeLength int
+}
+
+// Header returns the header of the compressed file.
+func (r *Reader) Header() Header {
+	h := Header{
+		Size:         int64(r.fileSize),
+		AlphabetSize: r.alphabet,
+		Backend:      Backend(r.flags & backendMask >> backendShift),
+		RLE:          r.flags&flagRLE != 0,
+		Symbols:      r.flags&(flagWide|flagRLE) == flagWide,
+		HasChecksum:  r.flags&flagCRC != 0,
+		Checksum:     r.checksum,
+		Name:         r.name,
+	}
+	if r.cb != nil {
+		for _, n := range r.cb.Lengths() {
+			if n > h.MaxCodeLength {
+				h.MaxCodeLength = n
+			}
+		}
+	}
+	return h
+}
+
+// writeName writes the length of name and then name itself.
+func writeName(w io.Writer, name string) error {
+	if len(name) > 0xffff {
+		return errNameLength
+	}
+	if err := binary.Write(w, binary.LittleEndian, uint16(len(name))); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, name)
+	return err
+}
+
+// readName reads a name written by writeName.
+func readName(r io.Reader) (string, error) {
+	var n uint16
+	if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+		return "", err
+	}
+	name := make([]byte, n)
+	if _, err := io.ReadFull(r, name); err != nil {
+		return "", err
+	}
+	return string(name), nil
+}
@@ -0,0 +1,81 @@
+package hzip
+
+import (
+	"bytes"
+	"hash/crc32"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func readHeader(t *testing.T, data []byte) Header {
+	r, err := NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r.Header()
+}
+
+func TestHeader(t *testing.T) {
+	compressed := roundTrip(t, []byte("aaaabbcd"))
+	assert.Equal(t, Header{
+		Size:          8,
+		AlphabetSize:  4,
+		Backend:       Huffman,
+		MaxCodeLength: 3,
+	}, readHeader(t, compressed))
+
+	compressed = roundTrip(t, []byte("aaaabbcd"), WithName("notes.txt"), WithChecksum(), WithBackend(TANS))
+	assert.Equal(t, Header{
+		Size:         8,
+		AlphabetSize: 4,
+		Backend:      TANS,
+		HasChecksum:  true,
+		Checksum:     crc32.ChecksumIEEE([]byte("aaaabbcd")),
+		Name:         "notes.txt",
+	}, readHeader(t, compressed))
+
+	compressed = roundTrip(t, make([]byte, 100), WithRLE(), WithName("zeros"))
+	h := readHeader(t, compressed)
+	assert.True(t, h.RLE)
+	assert.False(t, h.Symbols)
+	assert.Equal(t, "zeros", h.Name)
+	assert.Equal(t, int64(100), h.Size)
+
+	buf := new(bytes.Buffer)
+	w := NewSymbolWriter(buf)
+	w.WriteSymbols([]uint16{1000, 2000, 2000})
+	w.Close()
+	h = readHeader(t, buf.Bytes())
+	assert.True(t, h.Symbols)
+	assert.Equal(t, 2, h.AlphabetSize)
+	assert.Equal(t, int64(3), h.Size)
+}
+
+func TestHeaderNameTooLong(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf, WithName(strings.Repeat("x", 1<<16)))
+	w.Write([]byte("data"))
+	assert.Equal(t, errNameLength, w.Close())
+	assert.Zero(t, buf.Len())
+
+	roundTrip(t, []byte("data"), WithName(strings.Repeat("x", 1<<16-1)))
+}
+
+func TestTooLarge(t *testing.T) {
+	defer func(n int64) { maxSize = n }(maxSize)
+	maxSize = 4
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf)
+	w.Write([]byte("data!"))
+	assert.Equal(t, errTooLarge, w.Close())
+	assert.Zero(t, buf.Len())
+
+	sw := NewSymbolWriter(buf)
+	sw.WriteSymbols([]uint16{1, 2, 3, 4, 5})
+	assert.Equal(t, errTooLarge, sw.Close())
+	assert.Zero(t, buf.Len())
+
+	roundTrip(t, []byte("data"))
+}
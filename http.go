@@ -0,0 +1,226 @@
+package hzip
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+)
+
+var errNotHijacker = errors.New("hzip: response writer doesn't support hijacking")
+
+// ContentEncoding is the name of the HTTP content coding for hzip, as used in
+// the Accept-Encoding and Content-Encoding headers. It isn't registered with
+// IANA, so it's only understood by clients and servers that use this package.
+const ContentEncoding = "hzip"
+
+// NewHandler returns an http.Handler that calls h and compresses its
+// responses with hzip for requests that accept the hzip content coding.
+// Responses that already have a Content-Encoding or a Content-Range are left
+// alone.
+//
+// Since a Writer doesn't write anything until it's closed, compressed
+// responses are held in memory until h returns. If h flushes the response
+// through http.Flusher, as streaming responses do, the response is sent
+// uncompressed instead. Informational responses, such as 103 Early Hints, and
+// hijacking the connection through http.Hijacker are passed through.
+func NewHandler(h http.Handler) http.Handler {
+	return &handler{h: h}
+}
+
+type handler struct {
+	h http.Handler
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Vary", "Accept-Encoding")
+	if r.Method == http.MethodHead || !acceptsEncoding(r.Header.Get("Accept-Encoding"), ContentEncoding) {
+		h.h.ServeHTTP(w, r)
+		return
+	}
+	cw := &compressResponseWriter{ResponseWriter: w}
+	h.h.ServeHTTP(cw, r)
+	if err := cw.close(); err != nil {
+		// Abort the connection, so the client doesn't take a cut-off
+		// body for the whole response
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// acceptsEncoding reports whether the value of an Accept-Encoding header
+// allows the given content coding, either by name or with a wildcard.
+func acceptsEncoding(header, coding string) bool {
+	accepted, wildcard := false, false
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+		name := strings.TrimSpace(params[0])
+		ok := true
+		for _, param := range params[1:] {
+			param = strings.Replace(param, " ", "", -1)
+			if strings.HasPrefix(param, "q=") {
+				// A quality of zero means "not acceptable"
+				ok = strings.Trim(param[2:], "0.") != ""
+			}
+		}
+		if strings.EqualFold(name, coding) {
+			return ok
+		}
+		if name == "*" {
+			wildcard = true
+			accepted = ok
+		}
+	}
+	return wildcard && accepted
+}
+
+// compressResponseWriter compresses the body of the response, unless the
+// response can't have a body, is a partial response or already has a
+// Content-Encoding. The body is held until the handler returns, since it's
+// all compressed at once, or until the handler flushes it, which sends it
+// uncompressed instead so that streaming responses still stream.
+type compressResponseWriter struct {
+	http.ResponseWriter
+	code     int  // status code, once WriteHeader has been called
+	compress bool // the body is being held to be compressed
+	buf      []byte
+	hijacked bool // the handler took over the connection
+}
+
+func (w *compressResponseWriter) WriteHeader(code int) {
+	if code >= 100 && code < 200 {
+		// Informational responses, such as 103 Early Hints, come before
+		// the real one and have no body
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if w.code != 0 {
+		return
+	}
+	w.code = code
+	header := w.Header()
+	hasBody := code >= 200 && code != http.StatusNoContent && code != http.StatusNotModified
+	// Content-Range refers to offsets in the uncompressed body
+	partial := code == http.StatusPartialContent || header.Get("Content-Range") != ""
+	w.compress = hasBody && !partial && header.Get("Content-Encoding") == ""
+	if !w.compress {
+		w.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (w *compressResponseWriter) Write(p []byte) (int, error) {
+	if w.code == 0 {
+		// net/http sniffs the content type from the first write, which
+		// would be compressed data by then, so sniff it here instead
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", http.DetectContentType(p))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.compress {
+		return w.ResponseWriter.Write(p)
+	}
+	w.buf = append(w.buf, p...)
+	return len(p), nil
+}
+
+// Flush sends the response so far uncompressed, and stops compressing it.
+func (w *compressResponseWriter) Flush() {
+	if w.compress {
+		w.compress = false
+		w.ResponseWriter.WriteHeader(w.code)
+		w.ResponseWriter.Write(w.buf)
+		w.buf = nil
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack lets the handler take over the connection, if the underlying
+// ResponseWriter allows it. Nothing is compressed after that.
+func (w *compressResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errNotHijacker
+	}
+	conn, rw, err := h.Hijack()
+	if err == nil {
+		w.hijacked = true
+	}
+	return conn, rw, err
+}
+
+func (w *compressResponseWriter) close() error {
+	if w.hijacked {
+		return nil
+	}
+	if w.code == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.compress {
+		return nil
+	}
+	header := w.Header()
+	header.Set("Content-Encoding", ContentEncoding)
+	header.Del("Content-Length")
+	w.ResponseWriter.WriteHeader(w.code)
+	hw := NewWriter(w.ResponseWriter)
+	hw.Write(w.buf)
+	w.buf = nil
+	return hw.Close()
+}
+
+// Transport is an http.RoundTripper that asks for responses compressed with
+// hzip and transparently decompresses them, like http.Transport does for
+// gzip. Requests that already have an Accept-Encoding header are sent as they
+// are, and their responses are left alone.
+type Transport struct {
+	// Base is the RoundTripper that sends the requests. If nil,
+	// http.DefaultTransport is used.
+	Base http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if req.Header.Get("Accept-Encoding") != "" {
+		return base.RoundTrip(req)
+	}
+	// A RoundTripper isn't allowed to modify the request, so the header is
+	// set on a copy
+	clone := new(http.Request)
+	*clone = *req
+	clone.Header = make(http.Header, len(req.Header)+1)
+	for k, v := range req.Header {
+		clone.Header[k] = v
+	}
+	req = clone
+	req.Header.Set("Accept-Encoding", ContentEncoding)
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(resp.Header.Get("Content-Encoding"), ContentEncoding) {
+		resp.Body = &decompressBody{lazyReader: lazyReader{r: resp.Body}, body: resp.Body}
+		resp.Header.Del("Content-Encoding")
+		resp.Header.Del("Content-Length")
+		resp.ContentLength = -1
+		resp.Uncompressed = true
+	}
+	return resp, nil
+}
+
+// decompressBody decompresses a response body and closes the original body.
+type decompressBody struct {
+	lazyReader
+	body io.Closer
+}
+
+func (b *decompressBody) Close() error {
+	return b.body.Close()
+}
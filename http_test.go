@@ -0,0 +1,229 @@
+package hzip
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testJSON = `{"items": [{"id": 1, "name": "foo"}, {"id": 2, "name": "bar"}]}`
+
+func newTestServer() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, testJSON)
+	})
+	mux.HandleFunc("/sniff", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "<html><body>Hello</body></html>")
+	})
+	mux.HandleFunc("/encoded", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "identity")
+		io.WriteString(w, "as is")
+	})
+	mux.HandleFunc("/empty", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("/range", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "data.json", time.Time{}, strings.NewReader(testJSON))
+	})
+	mux.HandleFunc("/stream", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "first ")
+		w.(http.Flusher).Flush()
+		io.WriteString(w, "second")
+	})
+	return httptest.NewServer(NewHandler(mux))
+}
+
+func get(t *testing.T, url, acceptEncoding string) (*http.Response, string) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if acceptEncoding != "" {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(body)
+}
+
+func TestHandler(t *testing.T) {
+	ts := newTestServer()
+	defer ts.Close()
+
+	resp, body := get(t, ts.URL+"/json", "gzip, hzip")
+	assert.Equal(t, "hzip", resp.Header.Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", resp.Header.Get("Vary"))
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	r, err := NewReader(strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(r)
+	assert.Equal(t, testJSON, string(data))
+
+	// The content type is sniffed from the uncompressed data
+	resp, _ = get(t, ts.URL+"/sniff", "hzip")
+	assert.Equal(t, "text/html; charset=utf-8", resp.Header.Get("Content-Type"))
+
+	// Clients that don't accept hzip get the data as is
+	for _, accept := range []string{"gzip", "hzip;q=0", "*;q=0", "*, hzip;q=0.0"} {
+		resp, body = get(t, ts.URL+"/json", accept)
+		assert.Equal(t, "", resp.Header.Get("Content-Encoding"), accept)
+		assert.Equal(t, testJSON, body)
+	}
+
+	resp, body = get(t, ts.URL+"/encoded", "hzip")
+	assert.Equal(t, "identity", resp.Header.Get("Content-Encoding"))
+	assert.Equal(t, "as is", body)
+
+	// Partial responses aren't compressed, since Content-Range refers to
+	// the uncompressed body
+	req, _ := http.NewRequest("GET", ts.URL+"/range", nil)
+	req.Header.Set("Accept-Encoding", "hzip")
+	req.Header.Set("Range", "bytes=0-9")
+	rangeResp, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ = ioutil.ReadAll(rangeResp.Body)
+	rangeResp.Body.Close()
+	assert.Equal(t, http.StatusPartialContent, rangeResp.StatusCode)
+	assert.Equal(t, "", rangeResp.Header.Get("Content-Encoding"))
+	assert.Equal(t, testJSON[:10], string(data))
+	resp, body = get(t, ts.URL+"/range", "hzip")
+	assert.Equal(t, "hzip", resp.Header.Get("Content-Encoding"))
+
+	// Flushed responses are sent as they are
+	resp, body = get(t, ts.URL+"/stream", "hzip")
+	assert.Equal(t, "", resp.Header.Get("Content-Encoding"))
+	assert.Equal(t, "first second", body)
+
+	resp, body = get(t, ts.URL+"/empty", "hzip")
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.Equal(t, "", resp.Header.Get("Content-Encoding"))
+	assert.Equal(t, "", body)
+}
+
+func TestAcceptsEncoding(t *testing.T) {
+	assert.True(t, acceptsEncoding("hzip", "hzip"))
+	assert.True(t, acceptsEncoding("gzip, HZIP;q=0.5", "hzip"))
+	assert.True(t, acceptsEncoding("*", "hzip"))
+	assert.False(t, acceptsEncoding("", "hzip"))
+	assert.False(t, acceptsEncoding("gzip, deflate", "hzip"))
+	assert.False(t, acceptsEncoding("hzip; q=0", "hzip"))
+	assert.False(t, acceptsEncoding("*, hzip;q=0", "hzip"))
+}
+
+func TestTransport(t *testing.T) {
+	ts := newTestServer()
+	defer ts.Close()
+	client := &http.Client{Transport: &Transport{}}
+
+	resp, err := client.Get(ts.URL + "/json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Nil(t, err)
+	assert.Equal(t, testJSON, string(body))
+	assert.True(t, resp.Uncompressed)
+	assert.Equal(t, "", resp.Header.Get("Content-Encoding"))
+	assert.Equal(t, int64(-1), resp.ContentLength)
+
+	// Requests with their own Accept-Encoding are left alone
+	req, _ := http.NewRequest("GET", ts.URL+"/json", nil)
+	req.Header.Set("Accept-Encoding", "hzip")
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	assert.Equal(t, "hzip", resp.Header.Get("Content-Encoding"))
+	assert.False(t, resp.Uncompressed)
+}
+
+// headerWriter is an http.ResponseWriter that records the status codes
+// written, including informational ones.
+type headerWriter struct {
+	header http.Header
+	codes  []int
+	body   bytes.Buffer
+}
+
+func (w *headerWriter) Header() http.Header         { return w.header }
+func (w *headerWriter) WriteHeader(code int)        { w.codes = append(w.codes, code) }
+func (w *headerWriter) Write(p []byte) (int, error) { return w.body.Write(p) }
+
+func TestHandlerInformational(t *testing.T) {
+	h := NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Link", "</style.css>; rel=preload")
+		w.WriteHeader(http.StatusEarlyHints)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, testJSON)
+	}))
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "hzip")
+	w := &headerWriter{header: make(http.Header)}
+	h.ServeHTTP(w, req)
+
+	// The final status still gets through after the informational one
+	assert.Equal(t, []int{http.StatusEarlyHints, http.StatusOK}, w.codes)
+	assert.Equal(t, "hzip", w.header.Get("Content-Encoding"))
+	r, err := NewReader(&w.body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(r)
+	assert.Equal(t, testJSON, string(data))
+}
+
+func TestHandlerHijack(t *testing.T) {
+	panicked := make(chan interface{}, 1)
+	h := NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 8\r\nConnection: close\r\n\r\nhijacked")
+		rw.Flush()
+	}))
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() { panicked <- recover() }()
+		h.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	resp, body := get(t, ts.URL, "hzip")
+	assert.Equal(t, "", resp.Header.Get("Content-Encoding"))
+	assert.Equal(t, "hijacked", body)
+	// Nothing is written to the connection once the handler has it
+	assert.Nil(t, <-panicked)
+
+	// Without a Hijacker underneath, hijacking fails
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "hzip")
+	NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _, err := w.(http.Hijacker).Hijack()
+		assert.Equal(t, errNotHijacker, err)
+	})).ServeHTTP(&headerWriter{header: make(http.Header)}, req)
+}
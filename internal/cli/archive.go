@@ -0,0 +1,298 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/burakguven/hzip"
+)
+
+// archiveEntry is a file or directory to be added to an archive.
+type archiveEntry struct {
+	path string
+	name string
+	fi   os.FileInfo
+}
+
+// runArchive runs hzip ar, which creates, lists and extracts archives that
+// hold many files.
+func (c *Command) runArchive(args []string) int {
+	var create, list, extract bool
+	var dir string
+	r := &run{Command: c}
+	fs := flag.NewFlagSet(c.Name+" ar", flag.ContinueOnError)
+	fs.SetOutput(c.Stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(c.Stderr, "usage: %s ar -c|-l|-x [flags] archive [file ...]\n", c.Name)
+		fs.PrintDefaults()
+	}
+	boolFlag(fs, &create, "c", "create", "create an archive with the given files and directories")
+	boolFlag(fs, &list, "l", "list", "list the files in an archive")
+	boolFlag(fs, &extract, "x", "extract", "extract the given files, or all of them, from an archive")
+	stringFlag(fs, &dir, "C", "directory", ".", "extract the files into `dir`")
+	boolFlag(fs, &r.force, "f", "force", "overwrite existing files")
+
+	files, err := parseArgs(fs, args)
+	if err == flag.ErrHelp {
+		return ExitOK
+	} else if err != nil {
+		return ExitError
+	}
+	n := 0
+	for _, b := range []bool{create, list, extract} {
+		if b {
+			n++
+		}
+	}
+	if n != 1 || len(files) == 0 {
+		fs.Usage()
+		return ExitError
+	}
+	switch {
+	case create:
+		r.createArchive(files[0], files[1:])
+	case list:
+		r.listArchive(files[0])
+	case extract:
+		r.extractArchive(files[0], files[1:], dir)
+	}
+	return r.status
+}
+
+// createArchive creates the named archive from the given files and the
+// contents of the given directories.
+func (r *run) createArchive(name string, files []string) {
+	if _, err := os.Lstat(name); err == nil && !r.force {
+		r.warnf("%s already exists; not overwritten", name)
+		return
+	}
+	out, _ := os.Stat(name)
+	entries := r.collect(files, out)
+	if r.status == ExitError {
+		return
+	}
+	_, err := writeAtomic(name, nil, r.force, func(w io.Writer) error {
+		aw := hzip.NewArchiveWriter(w)
+		for _, e := range entries {
+			if err := addToArchive(aw, e); err != nil {
+				return err
+			}
+		}
+		return aw.Close()
+	})
+	if err == errExists {
+		r.warnf("%s already exists; not overwritten", name)
+	} else if err != nil {
+		r.fileError(name, err)
+	}
+}
+
+// collect returns the given files and directories, and everything in the
+// directories, as they're named in an archive. Special files, files outside
+// the current directory and the file out, which is the archive, are left out.
+func (r *run) collect(files []string, out os.FileInfo) []archiveEntry {
+	var entries []archiveEntry
+	for _, file := range files {
+		filepath.Walk(file, func(path string, fi os.FileInfo, err error) error {
+			if err != nil {
+				r.fileError(path, err)
+				return nil
+			}
+			if out != nil && os.SameFile(fi, out) {
+				// Don't add the archive to itself
+				return nil
+			}
+			if !fi.IsDir() && !fi.Mode().IsRegular() {
+				r.warnf("%s is not a directory or a regular file -- ignored", path)
+				return nil
+			}
+			name := strings.TrimLeft(filepath.ToSlash(filepath.Clean(path)), "/")
+			if name == "." || name == "" {
+				return nil
+			}
+			if name == ".." || strings.HasPrefix(name, "../") {
+				r.warnf("%s is outside the current directory -- ignored", path)
+				if fi.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			entries = append(entries, archiveEntry{path: path, name: name, fi: fi})
+			return nil
+		})
+	}
+	return entries
+}
+
+// addToArchive adds a file or directory to an archive.
+func addToArchive(aw *hzip.ArchiveWriter, e archiveEntry) error {
+	w, err := aw.Create(&hzip.ArchiveHeader{
+		Name:    e.name,
+		Mode:    e.fi.Mode(),
+		ModTime: e.fi.ModTime(),
+	})
+	if err != nil || e.fi.IsDir() {
+		return err
+	}
+	f, err := os.Open(e.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// openArchive opens the named archive. The returned file has to be closed.
+func openArchive(name string) (*hzip.ArchiveReader, *os.File, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	fi, err := f.Stat()
+	if err == nil {
+		var ar *hzip.ArchiveReader
+		ar, err = hzip.NewArchiveReader(f, fi.Size())
+		if err == nil {
+			return ar, f, nil
+		}
+	}
+	f.Close()
+	return nil, nil, err
+}
+
+// listArchive lists the files in the named archive.
+func (r *run) listArchive(name string) {
+	ar, f, err := openArchive(name)
+	if err != nil {
+		r.fileError(name, err)
+		return
+	}
+	defer f.Close()
+	fmt.Fprintf(r.Stdout, "%-10s %12s %12s %7s %-16s %s\n", "mode", "compressed", "uncompressed", "ratio", "modified", "name")
+	for _, af := range ar.File {
+		name := af.Name
+		if af.Mode.IsDir() {
+			name += "/"
+		}
+		fmt.Fprintf(r.Stdout, "%-10s %12d %12d %6.1f%% %-16s %s\n", af.Mode, af.CompressedSize, af.Size,
+			ratio(af.CompressedSize, af.Size), af.ModTime.Format("2006-01-02 15:04"), name)
+	}
+}
+
+// extractArchive extracts the given files from the named archive into dir.
+// Files in a directory that's given are extracted too. Without any files,
+// everything is extracted.
+func (r *run) extractArchive(name string, files []string, dir string) {
+	ar, f, err := openArchive(name)
+	if err != nil {
+		r.fileError(name, err)
+		return
+	}
+	defer f.Close()
+	for i, file := range files {
+		files[i] = strings.TrimSuffix(filepath.ToSlash(file), "/")
+	}
+	found := make(map[string]bool)
+	var dirs []extractedDir
+	for _, af := range ar.File {
+		if !selected(af.Name, files, found) {
+			continue
+		}
+		target := filepath.Join(dir, filepath.FromSlash(af.Name))
+		switch {
+		case af.Mode.IsDir():
+			if r.extractDir(target, af.Mode) {
+				dirs = append(dirs, extractedDir{target, af.FileInfo()})
+			}
+		case af.Mode.IsRegular():
+			r.extractFile(target, af.FileInfo(), func(w io.Writer) error {
+				hr, err := af.Open()
+				if err != nil {
+					return err
+				}
+				_, err = io.Copy(w, hr)
+				return err
+			})
+		default:
+			r.warnf("%s is not a directory or a regular file -- ignored", af.Name)
+		}
+	}
+	r.finishDirs(dirs)
+	for _, file := range files {
+		if !found[file] {
+			r.warnf("%s: not found in archive", file)
+		}
+	}
+}
+
+// An extractedDir is a directory that was extracted from an archive, with the
+// permissions and modification time that it gets at the end.
+type extractedDir struct {
+	path string
+	fi   os.FileInfo
+}
+
+// extractDir creates the directory target, and reports whether it succeeded.
+// The directory can be written to until finishDirs is called, whatever its
+// mode.
+func (r *run) extractDir(target string, mode os.FileMode) bool {
+	if err := os.MkdirAll(target, mode.Perm()|0700); err != nil {
+		r.fileError(target, err)
+		return false
+	}
+	return true
+}
+
+// finishDirs sets the permissions and modification times of extracted
+// directories. That has to be done last, since extracting the files in them
+// changes their modification time.
+func (r *run) finishDirs(dirs []extractedDir) {
+	for i := len(dirs) - 1; i >= 0; i-- {
+		d := dirs[i]
+		if err := os.Chmod(d.path, d.fi.Mode().Perm()); err != nil {
+			r.fileError(d.path, err)
+		}
+		os.Chtimes(d.path, d.fi.ModTime(), d.fi.ModTime())
+	}
+}
+
+// extractFile creates the file target with the contents written by write and
+// the permissions and modification time in fi, unless it already exists.
+func (r *run) extractFile(target string, fi os.FileInfo, write func(io.Writer) error) {
+	if _, err := os.Lstat(target); err == nil && !r.force {
+		r.warnf("%s already exists; not overwritten", target)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		r.fileError(target, err)
+		return
+	}
+	_, err := writeAtomic(target, fi, r.force, write)
+	if err == errExists {
+		r.warnf("%s already exists; not overwritten", target)
+	} else if err != nil {
+		r.fileError(target, err)
+	}
+}
+
+// selected reports whether the archive entry called name is one of files,
+// which are slash-separated, or is in one of them, and records which of files
+// it matched in found. Every entry is selected if there are no files.
+func selected(name string, files []string, found map[string]bool) bool {
+	if len(files) == 0 {
+		return true
+	}
+	ok := false
+	for _, file := range files {
+		if name == file || strings.HasPrefix(name, file+"/") {
+			found[file] = true
+			ok = true
+		}
+	}
+	return ok
+}
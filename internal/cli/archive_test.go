@@ -0,0 +1,124 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArchive(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "src")
+	mtime := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+	for _, d := range []string{"src", "src/sub"} {
+		if err := os.Mkdir(filepath.Join(dir, d), 0750); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile(t, filepath.Join(src, "a.txt"), "Hello World")
+	writeFile(t, filepath.Join(src, "sub", "b.txt"), strings.Repeat("abc", 1000))
+	if err := os.Chmod(filepath.Join(src, "a.txt"), 0604); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"src/a.txt", "src/sub/b.txt", "src/sub", "src"} {
+		if err := os.Chtimes(filepath.Join(dir, name), mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+
+	status, _, stderr := runCommand(false, nil, "ar", "-c", "out.hzar", "src")
+	assert.Equal(t, ExitOK, status, stderr)
+	assert.True(t, exists(filepath.Join(src, "a.txt")), "sources are kept")
+	// The archive gets the permissions of any new file, under the umask
+	f, err := os.OpenFile("new", os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	want, _ := os.Stat("new")
+	os.Remove("new")
+	if fi, err := os.Stat("out.hzar"); assert.NoError(t, err) {
+		assert.Equal(t, want.Mode().Perm(), fi.Mode().Perm())
+	}
+
+	// The archive isn't overwritten without -f
+	status, _, stderr = runCommand(false, nil, "ar", "-c", "out.hzar", "src")
+	assert.Equal(t, ExitWarning, status)
+	assert.Equal(t, "hzip: out.hzar already exists; not overwritten\n", stderr)
+
+	status, stdout, _ := runCommand(false, nil, "ar", "-l", "out.hzar")
+	assert.Equal(t, ExitOK, status)
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	if assert.Equal(t, 5, len(lines)) {
+		assert.Contains(t, lines[0], "uncompressed")
+		assert.True(t, strings.HasSuffix(lines[1], " src/"), lines[1])
+		assert.True(t, strings.HasPrefix(lines[2], "-rw----r--"), lines[2])
+		assert.True(t, strings.HasSuffix(lines[2], " src/a.txt"), lines[2])
+		assert.True(t, strings.HasSuffix(lines[4], " src/sub/b.txt"), lines[4])
+	}
+
+	// Extract everything into another directory
+	status, _, stderr = runCommand(false, nil, "ar", "-x", "-C", "dst", "out.hzar")
+	assert.Equal(t, ExitOK, status, stderr)
+	assert.Equal(t, "Hello World", readFile(t, "dst/src/a.txt"))
+	assert.Equal(t, strings.Repeat("abc", 1000), readFile(t, "dst/src/sub/b.txt"))
+	for name, perm := range map[string]os.FileMode{"dst/src/a.txt": 0604, "dst/src/sub": 0750, "dst/src": 0750} {
+		fi, err := os.Stat(name)
+		if assert.NoError(t, err) {
+			assert.Equal(t, perm, fi.Mode().Perm(), name)
+			assert.True(t, mtime.Equal(fi.ModTime()), "%s: %v", name, fi.ModTime())
+		}
+	}
+
+	// Existing files aren't overwritten without -f
+	status, _, stderr = runCommand(false, nil, "ar", "-x", "-C", "dst", "out.hzar", "src/a.txt")
+	assert.Equal(t, ExitWarning, status)
+	assert.Equal(t, "hzip: "+filepath.Join("dst", "src", "a.txt")+" already exists; not overwritten\n", stderr)
+
+	// Only extract some of the files
+	status, _, stderr = runCommand(false, nil, "ar", "-xC", "part", "out.hzar", "src/sub/", "missing")
+	assert.Equal(t, ExitWarning, status)
+	assert.Equal(t, "hzip: missing: not found in archive\n", stderr)
+	assert.True(t, exists("part/src/sub/b.txt"))
+	assert.False(t, exists("part/src/a.txt"))
+}
+
+func TestArchiveErrors(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	notArchive := filepath.Join(dir, "a.txt")
+	writeFile(t, notArchive, "Hello World")
+
+	status, _, stderr := runCommand(false, nil, "ar", notArchive)
+	assert.Equal(t, ExitError, status)
+	assert.Contains(t, stderr, "usage: hzip ar")
+
+	status, _, stderr = runCommand(false, nil, "ar", "-c", "-x", notArchive)
+	assert.Equal(t, ExitError, status)
+	assert.Contains(t, stderr, "usage: hzip ar")
+
+	status, _, stderr = runCommand(false, nil, "ar", "-l", notArchive)
+	assert.Equal(t, ExitError, status)
+	assert.Equal(t, "hzip: "+notArchive+": not a valid archive\n", stderr)
+
+	out := filepath.Join(dir, "out.hzar")
+	status, _, stderr = runCommand(false, nil, "ar", "-c", out, filepath.Join(dir, "missing"))
+	assert.Equal(t, ExitError, status)
+	assert.Equal(t, "hzip: "+filepath.Join(dir, "missing")+": no such file or directory\n", stderr)
+	assert.False(t, exists(out))
+
+	// hunzip doesn't have subcommands
+	status, _, stderr = runCommand(true, nil, "ar")
+	assert.Equal(t, ExitWarning, status)
+	assert.Equal(t, "hunzip: ar: unknown suffix -- ignored\n", stderr)
+}
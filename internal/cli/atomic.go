@@ -0,0 +1,143 @@
+package cli
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// errExists is returned by writeAtomic when the file it would create already
+// exists and it's not told to replace it.
+var errExists = errors.New("file exists")
+
+// A tempFile is the file that output is written to before it's renamed into
+// place. It's an interface so that tests can make it fail.
+type tempFile interface {
+	io.Writer
+	Name() string
+	Sync() error
+	Close() error
+}
+
+// createTemp creates a new temporary file in dir, with the permissions perm
+// before the umask.
+var createTemp = func(dir, prefix string, perm os.FileMode) (tempFile, error) {
+	f, err := openTemp(dir, prefix, perm)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// openTemp creates a new file in dir, with a name that starts with prefix and
+// the permissions perm before the umask. It's ioutil.TempFile, which always
+// uses 0600, with a choice of permissions.
+func openTemp(dir, prefix string, perm os.FileMode) (*os.File, error) {
+	r := uint32(time.Now().UnixNano() + int64(os.Getpid()))
+	for i := 0; ; i++ {
+		r = r*1664525 + 1013904223
+		name := filepath.Join(dir, prefix+strconv.FormatUint(uint64(r), 10))
+		f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, perm)
+		if os.IsExist(err) && i < 10000 {
+			continue
+		}
+		return f, err
+	}
+}
+
+// linkFile makes a hard link. It's a variable so that tests can make it fail
+// like it does on file systems without hard links.
+var linkFile = os.Link
+
+// writeAtomic creates the file name with the contents written by write, and
+// returns its size. The contents go to a temporary file in the same directory,
+// which is synced to disk, given the permissions and modification time of the
+// source file src, or 0666 less the umask and the current time if src is nil,
+// and then renamed to name. An existing file called name is only replaced if
+// replace is true, otherwise the temporary file is put in place by link, which
+// fails with errExists if something created name in the meantime. If anything
+// fails, name is left as it was and the temporary file is removed. If the
+// process is killed, the temporary file stays behind, and so can an empty name
+// on file systems without hard links.
+func writeAtomic(name string, src os.FileInfo, replace bool, write func(io.Writer) error) (int64, error) {
+	dir, base := filepath.Split(name)
+	if dir == "" {
+		dir = "."
+	}
+	perm := os.FileMode(0600)
+	if src == nil {
+		perm = 0666
+	}
+	f, err := createTemp(dir, "."+base+".tmp", perm)
+	if err != nil {
+		return 0, err
+	}
+	tmp := f.Name()
+	cw := &countWriter{w: f}
+	err = write(cw)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && src != nil {
+		err = os.Chmod(tmp, src.Mode().Perm())
+		if err == nil {
+			err = os.Chtimes(tmp, src.ModTime(), src.ModTime())
+		}
+	}
+	if err == nil && replace {
+		err = os.Rename(tmp, name)
+	} else if err == nil {
+		err = link(tmp, name)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return 0, err
+	}
+	syncDir(dir)
+	return cw.n, nil
+}
+
+// link puts the file tmp in place as name, unless name already exists. It
+// makes a hard link and removes tmp, so that an existing file is never
+// replaced. File systems without hard links get an empty file called name
+// instead, created only if it doesn't exist, which tmp is renamed over.
+func link(tmp, name string) error {
+	err := linkFile(tmp, name)
+	if err == nil {
+		os.Remove(tmp)
+		return nil
+	}
+	if os.IsExist(err) {
+		return errExists
+	}
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if os.IsExist(err) {
+		return errExists
+	} else if err != nil {
+		return err
+	}
+	f.Close()
+	if err := os.Rename(tmp, name); err != nil {
+		os.Remove(name)
+		return err
+	}
+	return nil
+}
+
+// syncDir syncs a directory to disk, so that a file renamed into it stays
+// there after a crash. Not every system can sync directories, so errors are
+// ignored.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
+}
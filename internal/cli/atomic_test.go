@@ -0,0 +1,188 @@
+package cli
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var errDiskFull = errors.New("disk full")
+
+// failingFile is a temporary file that fails once more than limit bytes have
+// been written to it, or when it's synced.
+type failingFile struct {
+	*os.File
+	limit    int
+	failSync bool
+}
+
+func (f *failingFile) Write(p []byte) (int, error) {
+	if len(p) > f.limit {
+		n, _ := f.File.Write(p[:f.limit])
+		f.limit = 0
+		return n, errDiskFull
+	}
+	f.limit -= len(p)
+	return f.File.Write(p)
+}
+
+func (f *failingFile) Sync() error {
+	if f.failSync {
+		return errDiskFull
+	}
+	return f.File.Sync()
+}
+
+// failTemp makes temporary files fail until the returned function is called.
+func failTemp(limit int, failSync bool) func() {
+	createTemp = func(dir, prefix string, perm os.FileMode) (tempFile, error) {
+		f, err := openTemp(dir, prefix, perm)
+		if err != nil {
+			return nil, err
+		}
+		return &failingFile{File: f, limit: limit, failSync: failSync}, nil
+	}
+	return func() {
+		createTemp = func(dir, prefix string, perm os.FileMode) (tempFile, error) {
+			return openTemp(dir, prefix, perm)
+		}
+	}
+}
+
+func dirNames(t *testing.T, dir string) []string {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, fi := range infos {
+		names = append(names, fi.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestAtomicOutput(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	a := filepath.Join(dir, "a.txt")
+	writeFile(t, a, "Hello World")
+	if err := os.Chmod(a, 0604); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+	if err := os.Chtimes(a, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+
+	status, _, _ := runCommand(false, nil, a)
+	assert.Equal(t, ExitOK, status)
+	assert.Equal(t, []string{"a.txt.hz"}, dirNames(t, dir))
+	fi, err := os.Stat(a + ".hz")
+	if assert.NoError(t, err) {
+		assert.Equal(t, os.FileMode(0604), fi.Mode().Perm())
+		assert.True(t, mtime.Equal(fi.ModTime()), "%v", fi.ModTime())
+	}
+
+	status, _, _ = runCommand(true, nil, a+".hz")
+	assert.Equal(t, ExitOK, status)
+	fi, err = os.Stat(a)
+	if assert.NoError(t, err) {
+		assert.Equal(t, os.FileMode(0604), fi.Mode().Perm())
+		assert.True(t, mtime.Equal(fi.ModTime()), "%v", fi.ModTime())
+	}
+}
+
+func TestAtomicOutputFailure(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	a := filepath.Join(dir, "a.txt")
+	writeFile(t, a, "Hello World")
+
+	for _, test := range []struct {
+		limit    int
+		failSync bool
+	}{
+		{0, false},
+		{10, false},
+		{1 << 20, true},
+	} {
+		restore := failTemp(test.limit, test.failSync)
+		status, _, stderr := runCommand(false, nil, a)
+		restore()
+		assert.Equal(t, ExitError, status)
+		assert.Equal(t, "hzip: "+a+": disk full\n", stderr)
+		// The source is still there, with no output or temporary file
+		assert.Equal(t, []string{"a.txt"}, dirNames(t, dir))
+	}
+
+	// An existing output file is left alone when overwriting it fails
+	writeFile(t, a+".hz", "old")
+	restore := failTemp(10, false)
+	status, _, _ := runCommand(false, nil, "-f", a)
+	restore()
+	assert.Equal(t, ExitError, status)
+	assert.Equal(t, []string{"a.txt", "a.txt.hz"}, dirNames(t, dir))
+	assert.Equal(t, "old", readFile(t, a+".hz"))
+}
+
+func TestAtomicOutputRace(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "out")
+
+	// Another process creates the output file after it was checked for but
+	// before it's put in place
+	_, err := writeAtomic(out, nil, false, func(w io.Writer) error {
+		writeFile(t, out, "theirs")
+		_, err := io.WriteString(w, "ours")
+		return err
+	})
+	assert.Equal(t, errExists, err)
+	assert.Equal(t, "theirs", readFile(t, out))
+	assert.Equal(t, []string{"out"}, dirNames(t, dir))
+
+	// Unless it's told to replace it
+	n, err := writeAtomic(out, nil, true, func(w io.Writer) error {
+		_, err := io.WriteString(w, "ours")
+		return err
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), n)
+	assert.Equal(t, "ours", readFile(t, out))
+	assert.Equal(t, []string{"out"}, dirNames(t, dir))
+}
+
+func TestAtomicOutputWithoutLinks(t *testing.T) {
+	linkFile = func(oldname, newname string) error {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: errors.New("operation not supported")}
+	}
+	defer func() { linkFile = os.Link }()
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "out")
+	write := func(w io.Writer) error {
+		_, err := io.WriteString(w, "ours")
+		return err
+	}
+
+	n, err := writeAtomic(out, nil, false, write)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), n)
+	assert.Equal(t, "ours", readFile(t, out))
+	assert.Equal(t, []string{"out"}, dirNames(t, dir))
+
+	// An existing file still isn't replaced
+	writeFile(t, out, "theirs")
+	_, err = writeAtomic(out, nil, false, write)
+	assert.Equal(t, errExists, err)
+	assert.Equal(t, "theirs", readFile(t, out))
+	assert.Equal(t, []string{"out"}, dirNames(t, dir))
+}
@@ -0,0 +1,358 @@
+package cli
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/lzw"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/burakguven/hzip"
+)
+
+var errMismatch = errors.New("decompressed data doesn't match the input")
+
+// A codec is a compression format that hzip bench measures.
+type codec struct {
+	name       string
+	compress   func(w io.Writer) (io.WriteCloser, error)
+	decompress func(r io.Reader) (io.Reader, error)
+}
+
+// hzipCodec returns a codec for hzip with the given options.
+func hzipCodec(name string, opts ...hzip.Option) codec {
+	return codec{
+		name: name,
+		compress: func(w io.Writer) (io.WriteCloser, error) {
+			return hzip.NewWriter(w, opts...), nil
+		},
+		decompress: func(r io.Reader) (io.Reader, error) {
+			return hzip.NewReader(r)
+		},
+	}
+}
+
+// codecs are the codecs that hzip bench compares, hzip's modes first and then
+// the standard library's.
+var codecs = []codec{
+	hzipCodec("hzip huffman"),
+	hzipCodec("hzip huffman+rle", hzip.WithRLE()),
+	hzipCodec("hzip arithmetic", hzip.WithBackend(hzip.Arithmetic)),
+	hzipCodec("hzip arithmetic+rle", hzip.WithBackend(hzip.Arithmetic), hzip.WithRLE()),
+	hzipCodec("hzip tans", hzip.WithBackend(hzip.TANS)),
+	hzipCodec("hzip tans+rle", hzip.WithBackend(hzip.TANS), hzip.WithRLE()),
+	{
+		name: "gzip",
+		compress: func(w io.Writer) (io.WriteCloser, error) {
+			return gzip.NewWriter(w), nil
+		},
+		decompress: func(r io.Reader) (io.Reader, error) {
+			return gzip.NewReader(r)
+		},
+	},
+	{
+		name: "flate huffman-only",
+		compress: func(w io.Writer) (io.WriteCloser, error) {
+			return flate.NewWriter(w, flate.HuffmanOnly)
+		},
+		decompress: func(r io.Reader) (io.Reader, error) {
+			return flate.NewReader(r), nil
+		},
+	},
+	{
+		name: "lzw",
+		compress: func(w io.Writer) (io.WriteCloser, error) {
+			return lzw.NewWriter(w, lzw.LSB, 8), nil
+		},
+		decompress: func(r io.Reader) (io.Reader, error) {
+			return lzw.NewReader(r, lzw.LSB, 8), nil
+		},
+	},
+}
+
+// A benchResult is the measurements for one codec and input.
+type benchResult struct {
+	size       int64
+	compressed int64
+	compress   time.Duration // fastest of the runs
+	decompress time.Duration
+	memory     uint64 // peak heap growth while compressing or decompressing
+}
+
+// runBench runs hzip bench, which compares how well and how fast hzip and the
+// standard library's compressors do on the given files.
+func (c *Command) runBench(args []string) int {
+	var runs int
+	r := &run{Command: c}
+	fs := flag.NewFlagSet(c.Name+" bench", flag.ContinueOnError)
+	fs.SetOutput(c.Stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(c.Stderr, "usage: %s bench [flags] [file ...]\n", c.Name)
+		fs.PrintDefaults()
+	}
+	fs.IntVar(&runs, "n", 3, "time the fastest of `n` runs of each codec")
+
+	files, err := parseArgs(fs, args)
+	if err == flag.ErrHelp {
+		return ExitOK
+	} else if err != nil {
+		return ExitError
+	}
+	if runs < 1 {
+		r.errorf("invalid number of runs %d", runs)
+		return r.status
+	}
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+	for i, name := range files {
+		var data []byte
+		if name == "-" {
+			name = "stdin"
+			data, err = ioutil.ReadAll(r.Stdin)
+		} else {
+			data, err = ioutil.ReadFile(name)
+		}
+		if err != nil {
+			r.fileError(name, err)
+			continue
+		}
+		if i > 0 {
+			fmt.Fprintln(r.Stdout)
+		}
+		r.bench(name, data, runs)
+	}
+	return r.status
+}
+
+// bench measures each codec on data and prints a table of the results.
+func (r *run) bench(name string, data []byte, runs int) {
+	fmt.Fprintf(r.Stdout, "%s: %d bytes\n", name, len(data))
+	fmt.Fprintf(r.Stdout, "%-20s %12s %7s %13s %13s %11s\n", "codec", "compressed", "ratio", "compress", "decompress", "peak heap")
+	for _, c := range codecs {
+		res, err := benchCodec(c, data, runs)
+		if err != nil {
+			r.fileError(name+": "+c.name, err)
+			continue
+		}
+		fmt.Fprintf(r.Stdout, "%-20s %12d %6.1f%% %13s %13s %11s\n", c.name, res.compressed,
+			ratio(res.compressed, res.size), throughput(res.size, res.compress),
+			throughput(res.size, res.decompress), formatBytes(int64(res.memory)))
+	}
+}
+
+// benchCodec compresses and decompresses data with c runs times, timing each
+// run, and then once more to measure the memory use.
+func benchCodec(c codec, data []byte, runs int) (benchResult, error) {
+	res := benchResult{size: int64(len(data))}
+	var compressed []byte
+	for i := 0; i < runs; i++ {
+		start := time.Now()
+		out, err := compressWith(c, data, nil)
+		if err != nil {
+			return res, err
+		}
+		if d := time.Since(start); i == 0 || d < res.compress {
+			res.compress = d
+		}
+		compressed = out
+	}
+	res.compressed = int64(len(compressed))
+	for i := 0; i < runs; i++ {
+		start := time.Now()
+		if err := decompressWith(c, compressed, data, nil); err != nil {
+			return res, err
+		}
+		if d := time.Since(start); i == 0 || d < res.decompress {
+			res.decompress = d
+		}
+	}
+
+	// Sampling the heap slows things down, so it gets its own runs
+	m := startMemSampler()
+	_, err := compressWith(c, data, m)
+	res.memory = m.stop()
+	if err != nil {
+		return res, err
+	}
+	m = startMemSampler()
+	err = decompressWith(c, compressed, data, m)
+	if mem := m.stop(); mem > res.memory {
+		res.memory = mem
+	}
+	return res, err
+}
+
+// compressWith compresses data with c. If m isn't nil, it samples the heap
+// as the data goes in and out.
+func compressWith(c codec, data []byte, m *memSampler) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := c.compress(m.writer(&buf))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := m.writer(w).Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decompressWith decompresses data with c, and checks that it gives want
+// without keeping a copy of the output. If m isn't nil, it samples the heap as
+// the data goes in and out.
+func decompressWith(c codec, data, want []byte, m *memSampler) error {
+	r, err := c.decompress(m.reader(bytes.NewReader(data)))
+	if err != nil {
+		return err
+	}
+	cw := &compareWriter{want: want}
+	if _, err := io.Copy(m.writer(cw), r); err != nil {
+		return err
+	}
+	if len(cw.want) > 0 {
+		return errMismatch
+	}
+	return nil
+}
+
+// compareWriter checks that the data written to it is the same as want.
+type compareWriter struct {
+	want []byte // the rest of the expected data
+}
+
+func (w *compareWriter) Write(p []byte) (int, error) {
+	if len(p) > len(w.want) || !bytes.Equal(p, w.want[:len(p)]) {
+		return 0, errMismatch
+	}
+	w.want = w.want[len(p):]
+	return len(p), nil
+}
+
+// throughput formats the rate at which n bytes were processed in d.
+func throughput(n int64, d time.Duration) string {
+	if d <= 0 {
+		return "-"
+	}
+	return formatBytes(int64(float64(n)/d.Seconds())) + "/s"
+}
+
+// A memSampler finds how much the heap grows at most while a codec runs. It
+// samples the heap every millisecond, and also whenever the codec reads or
+// writes, which catches the peaks in between that a timer alone would miss.
+// Short peaks between two samples can still be missed.
+type memSampler struct {
+	mu   sync.Mutex
+	base uint64
+	peak uint64
+	last time.Time // of the last sample taken on a read or write
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// startMemSampler starts sampling the heap, after a garbage collection to get
+// a baseline.
+func startMemSampler() *memSampler {
+	runtime.GC()
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	m := &memSampler{base: ms.HeapInuse, peak: ms.HeapInuse, done: make(chan struct{})}
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		t := time.NewTicker(time.Millisecond)
+		defer t.Stop()
+		for {
+			select {
+			case <-m.done:
+				return
+			case <-t.C:
+				m.sample()
+			}
+		}
+	}()
+	return m
+}
+
+// sample samples the heap.
+func (m *memSampler) sample() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	if ms.HeapInuse > m.peak {
+		m.peak = ms.HeapInuse
+	}
+}
+
+// sampleIO samples the heap on a read or write, unless that was last done
+// less than ioSampleInterval ago.
+func (m *memSampler) sampleIO() {
+	m.mu.Lock()
+	if time.Since(m.last) < ioSampleInterval {
+		m.mu.Unlock()
+		return
+	}
+	m.last = time.Now()
+	m.mu.Unlock()
+	m.sample()
+}
+
+// stop stops sampling and returns how much the heap grew at most.
+func (m *memSampler) stop() uint64 {
+	close(m.done)
+	m.wg.Wait()
+	m.sample()
+	return m.peak - m.base
+}
+
+// ioSampleInterval is how often reads and writes sample the heap at most,
+// since reading the memory statistics stops the world.
+const ioSampleInterval = 100 * time.Microsecond
+
+// writer returns w, sampling the heap after each write if m isn't nil.
+func (m *memSampler) writer(w io.Writer) io.Writer {
+	if m == nil {
+		return w
+	}
+	return &sampleWriter{w: w, m: m}
+}
+
+// reader returns r, sampling the heap after each read if m isn't nil.
+func (m *memSampler) reader(r io.Reader) io.Reader {
+	if m == nil {
+		return r
+	}
+	return &sampleReader{r: r, m: m}
+}
+
+type sampleWriter struct {
+	w io.Writer
+	m *memSampler
+}
+
+func (w *sampleWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.m.sampleIO()
+	return n, err
+}
+
+type sampleReader struct {
+	r io.Reader
+	m *memSampler
+}
+
+func (r *sampleReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.m.sampleIO()
+	return n, err
+}
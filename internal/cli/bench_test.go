@@ -0,0 +1,77 @@
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBench(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	a := filepath.Join(dir, "a.txt")
+	writeFile(t, a, strings.Repeat("Hello World\n", 1000))
+
+	status, stdout, stderr := runCommand(false, []byte("abcabcabc"), "bench", "-n", "1", a, "-")
+	assert.Equal(t, ExitOK, status, stderr)
+	tables := strings.Split(stdout, "\n\n")
+	if !assert.Equal(t, 2, len(tables)) {
+		return
+	}
+	for i, name := range []string{a + ": 12000 bytes", "stdin: 9 bytes"} {
+		lines := strings.Split(strings.TrimSpace(tables[i]), "\n")
+		assert.Equal(t, name, lines[0])
+		assert.Equal(t, len(codecs)+2, len(lines))
+		for j, c := range codecs {
+			assert.True(t, strings.HasPrefix(lines[j+2], c.name+" "), lines[j+2])
+		}
+	}
+	// Every codec was timed
+	for _, line := range strings.Split(tables[0], "\n")[2:] {
+		if line != "" {
+			assert.NotContains(t, line, " -", line)
+		}
+	}
+}
+
+func TestBenchErrors(t *testing.T) {
+	status, _, stderr := runCommand(false, nil, "bench", "-n", "0")
+	assert.Equal(t, ExitError, status)
+	assert.Equal(t, "hzip: invalid number of runs 0\n", stderr)
+
+	status, _, stderr = runCommand(false, nil, "bench", "missing")
+	assert.Equal(t, ExitError, status)
+	assert.Equal(t, "hzip: missing: no such file or directory\n", stderr)
+}
+
+func TestCompareWriter(t *testing.T) {
+	w := &compareWriter{want: []byte("abcdef")}
+	_, err := w.Write([]byte("abc"))
+	assert.NoError(t, err)
+	_, err = w.Write([]byte("dex"))
+	assert.Equal(t, errMismatch, err)
+	_, err = w.Write([]byte("defg"))
+	assert.Equal(t, errMismatch, err)
+}
+
+var sink []byte
+
+func TestMemSampler(t *testing.T) {
+	m := startMemSampler()
+	w := m.writer(ioutil.Discard)
+	// The buffer is garbage by the time the sampler stops, but a write
+	// samples the heap while it's still in use
+	sink = make([]byte, 8<<20)
+	w.Write(sink)
+	sink = nil
+	runtime.GC()
+	assert.True(t, m.stop() >= 8<<20)
+
+	var nilSampler *memSampler
+	assert.Equal(t, ioutil.Discard, nilSampler.writer(ioutil.Discard))
+}
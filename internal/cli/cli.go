@@ -0,0 +1,267 @@
+// Package cli implements the command line interface shared by the hzip and
+// hunzip commands. It works like gzip and gunzip: files given as arguments
+// are compressed into files with a suffix added to their names and then
+// removed, and standard input is compressed to standard output.
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Exit statuses, which are the same as gzip's.
+const (
+	ExitOK      = 0
+	ExitError   = 1
+	ExitWarning = 2 // some files were skipped
+)
+
+// DefaultSuffix is the suffix added to the names of compressed files.
+const DefaultSuffix = ".hz"
+
+// A Command is a run of hzip or hunzip.
+type Command struct {
+	Name       string // name of the command, used in messages
+	Decompress bool   // decompress unless told otherwise, like hunzip
+	Stdin      io.Reader
+	Stdout     io.Writer
+	Stderr     io.Writer
+}
+
+// config holds the command line flags.
+type config struct {
+	stdout     bool
+	keep       bool
+	force      bool
+	decompress bool
+	test       bool
+	list       bool
+	json       bool
+	recursive  bool
+	include    patterns
+	exclude    patterns
+	threads    int
+	progress   bool
+	suffix     string
+	tree       string
+}
+
+// run is the state of one call to Command.Run.
+type run struct {
+	*Command
+	config
+	status  int
+	listed  []listEntry // files listed with -l
+	summary summary     // files compressed or decompressed
+}
+
+// Run runs the command with the given arguments, not including the command
+// name, and returns the exit status. For hzip, a first argument of "ar", "tar"
+// or "bench" runs that subcommand instead.
+func (c *Command) Run(args []string) int {
+	if !c.Decompress && len(args) > 0 {
+		switch args[0] {
+		case "ar":
+			return c.runArchive(args[1:])
+		case "tar":
+			return c.runTar(args[1:])
+		case "bench":
+			return c.runBench(args[1:])
+		}
+	}
+	var cfg config
+	fs := flag.NewFlagSet(c.Name, flag.ContinueOnError)
+	fs.SetOutput(c.Stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(c.Stderr, "usage: %s [flags] [file ...]\n", c.Name)
+		fs.PrintDefaults()
+	}
+	boolFlag(fs, &cfg.stdout, "c", "stdout", "write to standard output and keep the input files")
+	boolFlag(fs, &cfg.decompress, "d", "decompress", "decompress instead of compressing")
+	boolFlag(fs, &cfg.force, "f", "force", "overwrite existing output files and write compressed data to a terminal")
+	boolFlag(fs, &cfg.keep, "k", "keep", "keep the input files")
+	boolFlag(fs, &cfg.test, "t", "test", "test the integrity of compressed files without writing any output")
+	boolFlag(fs, &cfg.list, "l", "list", "list the sizes, alphabet size, longest code and name of compressed files")
+	fs.BoolVar(&cfg.json, "json", false, "with -l, write the list as JSON")
+	boolFlag(fs, &cfg.recursive, "r", "recursive", "compress or decompress the files in directories and their subdirectories")
+	fs.Var(&cfg.include, "include", "with -r, only process files with names that match `pattern`; can be repeated")
+	fs.Var(&cfg.exclude, "exclude", "with -r, skip files with names that match `pattern`; can be repeated")
+	intFlag(fs, &cfg.threads, "T", "threads", 1, "process up to `n` files at once, or as many as there are CPUs if n is 0")
+	fs.BoolVar(&cfg.progress, "progress", false, "show the progress of each file on standard error, if it's a terminal and there's only one thread")
+	stringFlag(fs, &cfg.suffix, "S", "suffix", DefaultSuffix, "use `suffix` for compressed files")
+	fs.StringVar(&cfg.tree, "tree", "", "instead of compressing, write the Huffman tree for the input in the given `format` (dot or json)")
+
+	files, err := parseArgs(fs, args)
+	if err == flag.ErrHelp {
+		return ExitOK
+	} else if err != nil {
+		return ExitError
+	}
+	cfg.decompress = cfg.decompress || c.Decompress
+	r := &run{Command: c, config: cfg}
+	if r.suffix == "" || strings.ContainsRune(r.suffix, os.PathSeparator) {
+		r.errorf("invalid suffix %q", r.suffix)
+		return r.status
+	}
+	if err := r.include.check(); err != nil {
+		r.errorf("invalid include pattern: %v", err)
+		return r.status
+	}
+	if err := r.exclude.check(); err != nil {
+		r.errorf("invalid exclude pattern: %v", err)
+		return r.status
+	}
+	if r.threads < 0 {
+		r.errorf("invalid number of threads %d", r.threads)
+		return r.status
+	}
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+	r.runFiles(r.expand(files))
+	if r.list {
+		r.printList()
+	}
+	if r.recursive && !r.test && !r.list && r.tree == "" {
+		r.printSummary()
+	}
+	return r.status
+}
+
+// boolFlag defines a flag with a short and a long name.
+func boolFlag(fs *flag.FlagSet, p *bool, short, long, usage string) {
+	fs.BoolVar(p, short, false, usage)
+	fs.BoolVar(p, long, false, "same as -"+short)
+}
+
+// stringFlag defines a flag with a short and a long name.
+func stringFlag(fs *flag.FlagSet, p *string, short, long, value, usage string) {
+	fs.StringVar(p, short, value, usage)
+	fs.StringVar(p, long, value, "same as -"+short)
+}
+
+// intFlag defines a flag with a short and a long name.
+func intFlag(fs *flag.FlagSet, p *int, short, long string, value int, usage string) {
+	fs.IntVar(p, short, value, usage)
+	fs.IntVar(p, long, value, "same as -"+short)
+}
+
+// parseArgs parses the flags in args and returns the other arguments. Unlike
+// fs.Parse, flags can come after the file names, as with gzip, and short
+// boolean flags can be combined, as in -dc.
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	args = expandFlags(fs, args)
+	var files []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		rest := fs.Args()
+		if len(rest) == 0 {
+			return files, nil
+		}
+		if n := len(args) - len(rest); n > 0 && args[n-1] == "--" {
+			// Everything after -- is a file
+			return append(files, rest...), nil
+		}
+		files = append(files, rest[0])
+		args = rest[1:]
+	}
+}
+
+// expandFlags splits combined short flags, such as -dc into -d -c. An
+// argument is only split if it's made up of boolean flags, optionally
+// followed by a flag that takes a value, as in -kS.x or -kS .x.
+func expandFlags(fs *flag.FlagSet, args []string) []string {
+	var out []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			return append(out, args[i:]...)
+		}
+		if len(arg) < 3 || arg[0] != '-' || arg[1] == '-' || strings.Contains(arg, "=") {
+			out = append(out, arg)
+			if f := lookupFlag(fs, arg); f != nil && !isBoolFlag(f) && i+1 < len(args) {
+				// Don't split the value of the flag
+				i++
+				out = append(out, args[i])
+			}
+			continue
+		}
+		var split []string
+		for j := 1; j < len(arg); j++ {
+			f := fs.Lookup(arg[j : j+1])
+			if f == nil {
+				split = nil
+				break
+			}
+			split = append(split, "-"+f.Name)
+			if !isBoolFlag(f) {
+				if j+1 < len(arg) {
+					split = append(split, arg[j+1:])
+				} else if i+1 < len(args) {
+					i++
+					split = append(split, args[i])
+				}
+				break
+			}
+		}
+		if split == nil {
+			split = []string{arg}
+		}
+		out = append(out, split...)
+	}
+	return out
+}
+
+// lookupFlag returns the flag named by an argument such as -S or --suffix.
+func lookupFlag(fs *flag.FlagSet, arg string) *flag.Flag {
+	if !strings.HasPrefix(arg, "-") || strings.Contains(arg, "=") {
+		return nil
+	}
+	return fs.Lookup(strings.TrimLeft(arg, "-"))
+}
+
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// errorf reports an error, which makes the command exit with ExitError.
+func (r *run) errorf(format string, args ...interface{}) {
+	fmt.Fprintf(r.Stderr, r.Name+": "+format+"\n", args...)
+	r.status = ExitError
+}
+
+// warnf reports a warning, which makes the command exit with ExitWarning
+// unless there's also an error.
+func (r *run) warnf(format string, args ...interface{}) {
+	fmt.Fprintf(r.Stderr, r.Name+": "+format+"\n", args...)
+	if r.status == ExitOK {
+		r.status = ExitWarning
+	}
+}
+
+// fileError reports an error with a file, without repeating the file name
+// and operation that's in an *os.PathError, or the "hzip: " that the
+// library's errors start with.
+func (r *run) fileError(name string, err error) {
+	if pe, ok := err.(*os.PathError); ok {
+		err = pe.Err
+	}
+	r.errorf("%s: %s", name, strings.TrimPrefix(err.Error(), "hzip: "))
+}
+
+// isTerminal reports whether f is a terminal, or at least a character device.
+// It's a variable so that tests can pretend to be on a terminal.
+var isTerminal = func(f interface{}) bool {
+	file, ok := f.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := file.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,430 @@
+package cli
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// runCommand runs hzip, or hunzip if decompress is true, with the given
+// standard input and arguments.
+func runCommand(decompress bool, stdin []byte, args ...string) (status int, stdout, stderr string) {
+	name := "hzip"
+	if decompress {
+		name = "hunzip"
+	}
+	outBuf, errBuf := new(bytes.Buffer), new(bytes.Buffer)
+	c := &Command{
+		Name:       name,
+		Decompress: decompress,
+		Stdin:      bytes.NewReader(stdin),
+		Stdout:     outBuf,
+		Stderr:     errBuf,
+	}
+	status = c.Run(args)
+	return status, outBuf.String(), errBuf.String()
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "hzip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func writeFile(t *testing.T, name, data string) {
+	if err := ioutil.WriteFile(name, []byte(data), 0640); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, name string) string {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func exists(name string) bool {
+	_, err := os.Lstat(name)
+	return err == nil
+}
+
+func TestStream(t *testing.T) {
+	status, compressed, stderr := runCommand(false, []byte("Hello World\n"))
+	assert.Equal(t, ExitOK, status)
+	assert.Empty(t, stderr)
+
+	status, stdout, stderr := runCommand(true, []byte(compressed))
+	assert.Equal(t, ExitOK, status)
+	assert.Empty(t, stderr)
+	assert.Equal(t, "Hello World\n", stdout)
+
+	status, stdout, _ = runCommand(false, []byte(compressed), "-d", "-")
+	assert.Equal(t, ExitOK, status)
+	assert.Equal(t, "Hello World\n", stdout)
+
+	status, _, stderr = runCommand(true, []byte("not compressed"))
+	assert.Equal(t, ExitError, status)
+	assert.Contains(t, stderr, "hunzip: stdin: ")
+}
+
+func TestCompressFiles(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	a, b := filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")
+	writeFile(t, a, "aaaa")
+	writeFile(t, b, "bbbb")
+
+	status, stdout, stderr := runCommand(false, nil, a, b)
+	assert.Equal(t, ExitOK, status)
+	assert.Empty(t, stdout)
+	assert.Empty(t, stderr)
+	assert.False(t, exists(a))
+	assert.False(t, exists(b))
+	fi, err := os.Stat(a + ".hz")
+	if assert.NoError(t, err) {
+		assert.Equal(t, os.FileMode(0640), fi.Mode().Perm())
+	}
+
+	status, _, stderr = runCommand(true, nil, a+".hz", b+".hz")
+	assert.Equal(t, ExitOK, status)
+	assert.Empty(t, stderr)
+	assert.Equal(t, "aaaa", readFile(t, a))
+	assert.Equal(t, "bbbb", readFile(t, b))
+	assert.False(t, exists(a+".hz"))
+	assert.False(t, exists(b+".hz"))
+}
+
+func TestKeepAndStdout(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	a := filepath.Join(dir, "a.txt")
+	writeFile(t, a, "Hello World")
+
+	status, _, _ := runCommand(false, nil, "-k", a)
+	assert.Equal(t, ExitOK, status)
+	assert.True(t, exists(a))
+	assert.True(t, exists(a+".hz"))
+	compressed := readFile(t, a+".hz")
+
+	// -c writes to stdout and keeps the input
+	status, stdout, _ := runCommand(false, nil, "-c", a)
+	assert.Equal(t, ExitOK, status)
+	assert.Equal(t, compressed, stdout)
+	assert.True(t, exists(a))
+
+	// Combined flags, after the file name
+	status, stdout, _ = runCommand(false, nil, a+".hz", "-dc")
+	assert.Equal(t, ExitOK, status)
+	assert.Equal(t, "Hello World", stdout)
+	assert.True(t, exists(a+".hz"))
+}
+
+func TestForce(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	a := filepath.Join(dir, "a.txt")
+	writeFile(t, a, "new")
+	writeFile(t, a+".hz", "old")
+
+	status, _, stderr := runCommand(false, nil, a)
+	assert.Equal(t, ExitWarning, status)
+	assert.Equal(t, "hzip: "+a+".hz already exists; not overwritten\n", stderr)
+	assert.Equal(t, "old", readFile(t, a+".hz"))
+	assert.True(t, exists(a))
+
+	status, _, stderr = runCommand(false, nil, "--force", a)
+	assert.Equal(t, ExitOK, status)
+	assert.Empty(t, stderr)
+	assert.False(t, exists(a))
+
+	status, stdout, _ := runCommand(true, nil, "-c", a+".hz")
+	assert.Equal(t, ExitOK, status)
+	assert.Equal(t, "new", stdout)
+}
+
+func TestSuffix(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	a := filepath.Join(dir, "a.txt")
+	writeFile(t, a, "data")
+
+	status, _, _ := runCommand(false, nil, "-S", ".huff", a)
+	assert.Equal(t, ExitOK, status)
+	assert.True(t, exists(a+".huff"))
+
+	// Already has the suffix
+	status, _, stderr := runCommand(false, nil, "-S.huff", a+".huff")
+	assert.Equal(t, ExitWarning, status)
+	assert.Equal(t, "hzip: "+a+".huff already has .huff suffix -- unchanged\n", stderr)
+
+	// Unknown suffix when decompressing
+	status, _, stderr = runCommand(true, nil, a+".huff")
+	assert.Equal(t, ExitWarning, status)
+	assert.Equal(t, "hunzip: "+a+".huff: unknown suffix -- ignored\n", stderr)
+
+	status, _, _ = runCommand(true, nil, "--suffix=.huff", a+".huff")
+	assert.Equal(t, ExitOK, status)
+	assert.Equal(t, "data", readFile(t, a))
+
+	status, _, stderr = runCommand(false, nil, "-S", "", a)
+	assert.Equal(t, ExitError, status)
+	assert.Equal(t, "hzip: invalid suffix \"\"\n", stderr)
+}
+
+func TestErrors(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	missing := filepath.Join(dir, "missing")
+	a := filepath.Join(dir, "a.txt")
+	writeFile(t, a, "data")
+
+	// Errors win over warnings, and the other files are still processed
+	status, _, stderr := runCommand(false, nil, missing, dir, a)
+	assert.Equal(t, ExitError, status)
+	assert.Equal(t, []string{
+		"hzip: " + missing + ": no such file or directory",
+		"hzip: " + dir + " is a directory -- ignored",
+	}, strings.Split(strings.TrimSpace(stderr), "\n"))
+	assert.True(t, exists(a+".hz"))
+
+	// A corrupt file leaves no output behind
+	bad := filepath.Join(dir, "bad.hz")
+	writeFile(t, bad, "not compressed")
+	status, _, stderr = runCommand(true, nil, bad)
+	assert.Equal(t, ExitError, status)
+	assert.Contains(t, stderr, "hunzip: "+bad+": ")
+	assert.False(t, exists(filepath.Join(dir, "bad")))
+	assert.True(t, exists(bad))
+
+	// Unknown flags
+	status, _, stderr = runCommand(false, nil, "-x")
+	assert.Equal(t, ExitError, status)
+	assert.Contains(t, stderr, "flag provided but not defined: -x")
+}
+
+func TestTree(t *testing.T) {
+	status, stdout, _ := runCommand(false, []byte("aab"), "-tree", "json")
+	assert.Equal(t, ExitOK, status)
+	assert.JSONEq(t, `{
+		"freq": 3, "code": "",
+		"left": {"symbol": 98, "freq": 1, "code": "0"},
+		"right": {"symbol": 97, "freq": 2, "code": "1"}
+	}`, stdout)
+
+	status, _, stderr := runCommand(false, []byte("aab"), "-tree", "xml")
+	assert.Equal(t, ExitError, status)
+	assert.Equal(t, "hzip: stdin: unknown tree format \"xml\"\n", stderr)
+}
+
+func TestExpandFlags(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	var b bool
+	var s string
+	boolFlag(fs, &b, "c", "stdout", "")
+	boolFlag(fs, &b, "d", "decompress", "")
+	stringFlag(fs, &s, "S", "suffix", "", "")
+
+	tests := []struct {
+		args, want []string
+	}{
+		{[]string{"-dc", "file"}, []string{"-d", "-c", "file"}},
+		{[]string{"-dS.x"}, []string{"-d", "-S", ".x"}},
+		{[]string{"-dS", ".x"}, []string{"-d", "-S", ".x"}},
+		{[]string{"-S", "-dc"}, []string{"-S", "-dc"}},
+		{[]string{"--stdout", "-dx"}, []string{"--stdout", "-dx"}},
+		{[]string{"--", "-dc"}, []string{"--", "-dc"}},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.want, expandFlags(fs, test.args), "%q", test.args)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	good, bad, short := filepath.Join(dir, "good"), filepath.Join(dir, "bad"), filepath.Join(dir, "short")
+	data := strings.Repeat("the quick brown fox jumps over the lazy dog\n", 100)
+	for _, name := range []string{good, bad, short} {
+		writeFile(t, name, data)
+	}
+	status, _, _ := runCommand(false, nil, good, bad, short)
+	assert.Equal(t, ExitOK, status)
+
+	// Flip a bit in the data, and cut off the end of the data
+	compressed := readFile(t, bad+".hz")
+	i := len(compressed) - 10
+	writeFile(t, bad+".hz", compressed[:i]+string(compressed[i]^0x10)+compressed[i+1:])
+	writeFile(t, short+".hz", compressed[:len(compressed)-10])
+
+	status, stdout, stderr := runCommand(false, nil, "-t", good+".hz", bad+".hz", short+".hz")
+	assert.Equal(t, ExitError, status)
+	assert.Equal(t, good+".hz: OK\n"+bad+".hz: FAILED\n"+short+".hz: FAILED\n", stdout)
+	assert.Contains(t, stderr, "hzip: "+bad+".hz: checksum mismatch\n")
+	assert.Contains(t, stderr, "hzip: "+short+".hz: unexpected EOF\n")
+	// Nothing is written or removed
+	assert.True(t, exists(good+".hz"))
+	assert.False(t, exists(good))
+
+	status, stdout, _ = runCommand(true, []byte(readFile(t, good+".hz")), "--test")
+	assert.Equal(t, ExitOK, status)
+	assert.Equal(t, "stdin: OK\n", stdout)
+}
+
+func TestList(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	a, b := filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")
+	writeFile(t, a, "aaaabbcd")
+	writeFile(t, b, strings.Repeat("b", 1000))
+	status, _, _ := runCommand(false, nil, a, b)
+	assert.Equal(t, ExitOK, status)
+	// A file without a stored name is listed by its own name
+	c := filepath.Join(dir, "c.txt")
+	status, stdout, _ := runCommand(false, []byte("aaaabbcd"))
+	assert.Equal(t, ExitOK, status)
+	writeFile(t, c+".hz", stdout)
+
+	aSize, bSize, cSize := len(readFile(t, a+".hz")), len(readFile(t, b+".hz")), len(stdout)
+	status, stdout, stderr := runCommand(false, nil, "-l", a+".hz", b+".hz", c+".hz")
+	assert.Equal(t, ExitOK, status)
+	assert.Empty(t, stderr)
+	assert.Equal(t, fmt.Sprintf(""+
+		"  compressed uncompressed   ratio alphabet max code name\n"+
+		"%12d            8 %6.1f%%        4        3 a.txt\n"+
+		"%12d         1000 %6.1f%%        1        - b.txt\n"+
+		"%12d            8 %6.1f%%        4        3 %s\n"+
+		"%12d         1016 %6.1f%%                   (totals)\n",
+		aSize, ratio(int64(aSize), 8),
+		bSize, ratio(int64(bSize), 1000),
+		cSize, ratio(int64(cSize), 8), c,
+		aSize+bSize+cSize, ratio(int64(aSize+bSize+cSize), 1016),
+	), stdout)
+
+	status, stdout, _ = runCommand(true, []byte(readFile(t, b+".hz")), "-l", "--json")
+	assert.Equal(t, ExitOK, status)
+	assert.JSONEq(t, fmt.Sprintf(`{
+		"files": [{
+			"file": "-", "name": "b.txt", "compressed": %d, "uncompressed": 1000,
+			"ratio": %v, "alphabet_size": 1, "backend": "huffman", "max_code_length": 0
+		}],
+		"totals": {"compressed": %[1]d, "uncompressed": 1000, "ratio": %[2]v}
+	}`, bSize, ratio(int64(bSize), 1000)), stdout)
+
+	status, _, stderr = runCommand(false, nil, "-l", a)
+	assert.Equal(t, ExitError, status)
+	assert.Contains(t, stderr, "hzip: "+a+": ")
+}
+
+func TestRecursive(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	sub := filepath.Join(dir, "sub")
+	if err := os.Mkdir(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"a.txt":       "aaaa",
+		"b.log":       "bbbb",
+		"c.txt.hz":    "not really compressed",
+		"sub/d.txt":   "dddd",
+		"sub/e.txt":   "eeee",
+		"sub/f.draft": "ffff",
+	}
+	for name, data := range files {
+		writeFile(t, filepath.Join(dir, name), data)
+	}
+	if err := os.Symlink("a.txt", filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	status, _, stderr := runCommand(false, nil, "-r", "--include", "*.txt", "--include", "*.draft", "--exclude", "e.*", dir)
+	assert.Equal(t, ExitOK, status)
+	assert.Regexp(t, `^hzip: compressed 3 files, 12 -> \d+ bytes \(-?\d+\.\d%\), 4 skipped, 0 failed\n$`, stderr)
+	for _, name := range []string{"a.txt.hz", "b.log", "c.txt.hz", "sub/d.txt.hz", "sub/e.txt", "sub/f.draft.hz", "link"} {
+		assert.True(t, exists(filepath.Join(dir, name)), name)
+	}
+	for _, name := range []string{"a.txt", "sub/d.txt", "sub/f.draft"} {
+		assert.False(t, exists(filepath.Join(dir, name)), name)
+	}
+
+	// Decompressing fails on the file that isn't really compressed, and
+	// carries on with the others
+	status, _, stderr = runCommand(true, nil, "--recursive", dir)
+	assert.Equal(t, ExitError, status)
+	lines := strings.Split(strings.TrimSpace(stderr), "\n")
+	if assert.Len(t, lines, 2) {
+		assert.Contains(t, lines[0], "hunzip: "+filepath.Join(dir, "c.txt.hz")+": ")
+		assert.Regexp(t, `^hunzip: decompressed 3 files, \d+ -> 12 bytes \(-?\d+\.\d%\), 3 skipped, 1 failed$`, lines[1])
+	}
+	for name, data := range files {
+		if name != "c.txt.hz" {
+			assert.Equal(t, data, readFile(t, filepath.Join(dir, name)), name)
+		}
+	}
+
+	status, _, stderr = runCommand(false, nil, "-r", "--exclude", "[", dir)
+	assert.Equal(t, ExitError, status)
+	assert.Equal(t, "hzip: invalid exclude pattern: [: syntax error in pattern\n", stderr)
+
+	// Without -r, directories are skipped
+	status, _, _ = runCommand(false, nil, dir)
+	assert.Equal(t, ExitWarning, status)
+}
+
+func TestThreads(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	var names []string
+	for i := 0; i < 20; i++ {
+		name := filepath.Join(dir, fmt.Sprintf("%02d.txt", i))
+		writeFile(t, name, strings.Repeat(fmt.Sprint(i), 1000*i))
+		names = append(names, name)
+	}
+	status, _, _ := runCommand(false, nil, append([]string{"-T", "4"}, names...)...)
+	assert.Equal(t, ExitOK, status)
+	for _, name := range names {
+		assert.True(t, exists(name+".hz"), name)
+		assert.False(t, exists(name), name)
+	}
+
+	// Break some of the files, and test and decompress them all with and
+	// without threads
+	var compressed []string
+	for i, name := range names {
+		if i%3 == 0 {
+			writeFile(t, name+".hz", "not compressed")
+		}
+		compressed = append(compressed, name+".hz")
+	}
+	status1, stdout1, stderr1 := runCommand(false, nil, append([]string{"-t"}, compressed...)...)
+	status2, stdout2, stderr2 := runCommand(false, nil, append([]string{"-t", "--threads=0"}, compressed...)...)
+	assert.Equal(t, ExitError, status1)
+	assert.Equal(t, status1, status2)
+	assert.Equal(t, stdout1, stdout2)
+	assert.Equal(t, stderr1, stderr2)
+	assert.Equal(t, 7, strings.Count(stdout1, "FAILED"))
+
+	status, stdout, stderr := runCommand(true, nil, append([]string{"-T", "8", "-k"}, compressed...)...)
+	assert.Equal(t, ExitError, status)
+	assert.Empty(t, stdout)
+	assert.Equal(t, strings.Replace(stderr1, "hzip:", "hunzip:", -1), stderr)
+	for i, name := range names {
+		// The broken files leave nothing behind
+		assert.Equal(t, i%3 != 0, exists(name), name)
+	}
+
+	status, _, stderr = runCommand(false, nil, "-T", "-1", names[0])
+	assert.Equal(t, ExitError, status)
+	assert.Equal(t, "hzip: invalid number of threads -1\n", stderr)
+}
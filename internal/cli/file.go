@@ -0,0 +1,202 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/burakguven/hzip"
+)
+
+// file compresses or decompresses the named file, or standard input if the
+// name is "-".
+func (r *run) file(name string) {
+	switch {
+	case name == "-":
+		r.stream()
+	case r.test:
+		r.verifyFile(name)
+	case r.list:
+		r.listFile(name)
+	case r.tree != "":
+		f, err := os.Open(name)
+		if err != nil {
+			r.fileError(name, err)
+			return
+		}
+		defer f.Close()
+		if err := writeTree(r.Stdout, f, r.tree); err != nil {
+			r.fileError(name, err)
+		}
+	case r.decompress:
+		if !strings.HasSuffix(name, r.suffix) || len(name) == len(r.suffix) {
+			r.warnf("%s: unknown suffix -- ignored", name)
+			r.summary.skipped++
+			return
+		}
+		r.convert(name, strings.TrimSuffix(name, r.suffix), decompress)
+	default:
+		if strings.HasSuffix(name, r.suffix) {
+			r.warnf("%s already has %s suffix -- unchanged", name, r.suffix)
+			r.summary.skipped++
+			return
+		}
+		r.convert(name, name+r.suffix, func(dst io.Writer, src io.Reader, opts ...hzip.Option) error {
+			return compress(dst, src, append(opts[:len(opts):len(opts)], hzip.WithName(filepath.Base(name)))...)
+		})
+	}
+}
+
+// stream compresses or decompresses standard input to standard output.
+func (r *run) stream() {
+	var err error
+	switch {
+	case r.test:
+		r.verify("stdin", r.Stdin)
+		return
+	case r.list:
+		r.listStream()
+		return
+	case r.tree != "":
+		err = writeTree(r.Stdout, r.Stdin, r.tree)
+	case r.decompress:
+		if isTerminal(r.Stdin) && !r.force {
+			r.errorf("compressed data not read from a terminal. Use -f to force decompression.")
+			return
+		}
+		opts, clear := r.progressOptions("stdin")
+		err = decompress(r.Stdout, r.Stdin, opts...)
+		clear()
+	default:
+		if isTerminal(r.Stdout) && !r.force {
+			r.errorf("compressed data not written to a terminal. Use -f to force compression.")
+			return
+		}
+		opts, clear := r.progressOptions("stdin")
+		err = compress(r.Stdout, r.Stdin, opts...)
+		clear()
+	}
+	if err != nil {
+		r.fileError("stdin", err)
+	}
+}
+
+// convert compresses or decompresses the file in into the file out with fn,
+// and removes in unless it's told to keep it. With -c, it writes to standard
+// output instead. The output file only appears once it's complete, see
+// writeAtomic.
+func (r *run) convert(in, out string, fn func(dst io.Writer, src io.Reader, opts ...hzip.Option) error) {
+	fi, err := os.Lstat(in)
+	if err != nil {
+		r.fileError(in, err)
+		r.summary.failed++
+		return
+	}
+	if fi.IsDir() {
+		r.warnf("%s is a directory -- ignored", in)
+		r.summary.skipped++
+		return
+	}
+	if !fi.Mode().IsRegular() {
+		r.warnf("%s is not a directory or a regular file -- ignored", in)
+		r.summary.skipped++
+		return
+	}
+	src, err := os.Open(in)
+	if err != nil {
+		r.fileError(in, err)
+		r.summary.failed++
+		return
+	}
+	defer src.Close()
+	opts, clear := r.progressOptions(in)
+	defer clear()
+	if r.stdout {
+		cw := &countWriter{w: r.Stdout}
+		if err := fn(cw, src, opts...); err != nil {
+			r.fileError(in, err)
+			r.summary.failed++
+			return
+		}
+		r.summary.add(fi.Size(), cw.n)
+		return
+	}
+
+	if _, err := os.Lstat(out); err == nil && !r.force {
+		r.warnf("%s already exists; not overwritten", out)
+		r.summary.skipped++
+		return
+	}
+	n, err := writeAtomic(out, fi, r.force, func(dst io.Writer) error {
+		return fn(dst, src, opts...)
+	})
+	if err == errExists {
+		r.warnf("%s already exists; not overwritten", out)
+		r.summary.skipped++
+		return
+	}
+	if err != nil {
+		r.fileError(in, err)
+		r.summary.failed++
+		return
+	}
+	r.summary.add(fi.Size(), n)
+	if !r.keep {
+		src.Close()
+		if err := os.Remove(in); err != nil {
+			r.fileError(in, err)
+		}
+	}
+}
+
+// compress compresses src to dst.
+func compress(dst io.Writer, src io.Reader, opts ...hzip.Option) error {
+	bw := bufio.NewWriter(dst)
+	w := hzip.NewWriter(bw, append(opts[:len(opts):len(opts)], hzip.WithChecksum())...)
+	if _, err := io.Copy(w, src); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// decompress decompresses src to dst.
+func decompress(dst io.Writer, src io.Reader, opts ...hzip.Option) error {
+	r, err := hzip.NewReader(bufio.NewReader(src), opts...)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(dst)
+	if _, err := io.Copy(bw, r); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// writeTree writes the tree for the bytes read from r in the given format.
+func writeTree(w io.Writer, r io.Reader, format string) error {
+	var write func(io.Writer, map[uint16]int) error
+	switch format {
+	case "dot":
+		write = hzip.WriteTreeDOT
+	case "json":
+		write = hzip.WriteTreeJSON
+	default:
+		return fmt.Errorf("unknown tree format %q", format)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	freqs := make(map[uint16]int)
+	for _, b := range data {
+		freqs[uint16(b)]++
+	}
+	return write(w, freqs)
+}
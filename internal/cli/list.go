@@ -0,0 +1,147 @@
+package cli
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/burakguven/hzip"
+)
+
+// A listEntry is a file listed with -l.
+type listEntry struct {
+	File          string  `json:"file"`
+	Name          string  `json:"name"`
+	Compressed    int64   `json:"compressed"`
+	Uncompressed  int64   `json:"uncompressed"`
+	Ratio         float64 `json:"ratio"`
+	AlphabetSize  int     `json:"alphabet_size"`
+	Backend       string  `json:"backend"`
+	MaxCodeLength int     `json:"max_code_length"`
+}
+
+// listTotals is the last line of the list.
+type listTotals struct {
+	Compressed   int64   `json:"compressed"`
+	Uncompressed int64   `json:"uncompressed"`
+	Ratio        float64 `json:"ratio"`
+}
+
+// listFile lists the named compressed file, only reading its header.
+func (r *run) listFile(name string) {
+	f, err := os.Open(name)
+	if err != nil {
+		r.fileError(name, err)
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		r.fileError(name, err)
+		return
+	}
+	if !fi.Mode().IsRegular() {
+		r.warnf("%s is not a regular file -- ignored", name)
+		return
+	}
+	hr, err := hzip.NewReader(bufio.NewReader(f))
+	if err != nil {
+		r.fileError(name, err)
+		return
+	}
+	r.addListEntry(name, strings.TrimSuffix(name, r.suffix), fi.Size(), hr.Header())
+}
+
+// listStream lists the compressed data on standard input. Its size isn't
+// known without reading all of it.
+func (r *run) listStream() {
+	cr := &countReader{r: r.Stdin}
+	hr, err := hzip.NewReader(bufio.NewReader(cr))
+	if err == nil {
+		_, err = io.Copy(ioutil.Discard, cr)
+	}
+	if err != nil {
+		r.fileError("stdin", err)
+		return
+	}
+	r.addListEntry("-", "stdout", cr.n, hr.Header())
+}
+
+func (r *run) addListEntry(file, name string, size int64, h hzip.Header) {
+	if h.Name != "" {
+		name = h.Name
+	}
+	r.listed = append(r.listed, listEntry{
+		File:          file,
+		Name:          name,
+		Compressed:    size,
+		Uncompressed:  h.Size,
+		Ratio:         ratio(size, h.Size),
+		AlphabetSize:  h.AlphabetSize,
+		Backend:       h.Backend.String(),
+		MaxCodeLength: h.MaxCodeLength,
+	})
+}
+
+// ratio returns how much smaller the compressed size is than the
+// uncompressed size, as a percentage.
+func ratio(compressed, uncompressed int64) float64 {
+	if uncompressed == 0 {
+		return 0
+	}
+	return 100 * float64(uncompressed-compressed) / float64(uncompressed)
+}
+
+// printList prints the listed files and their totals, like gzip -l, or as
+// JSON.
+func (r *run) printList() {
+	var totals listTotals
+	for _, e := range r.listed {
+		totals.Compressed += e.Compressed
+		totals.Uncompressed += e.Uncompressed
+	}
+	totals.Ratio = ratio(totals.Compressed, totals.Uncompressed)
+	if r.json {
+		entries := r.listed
+		if entries == nil {
+			entries = []listEntry{}
+		}
+		enc := json.NewEncoder(r.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(struct {
+			Files  []listEntry `json:"files"`
+			Totals listTotals  `json:"totals"`
+		}{entries, totals})
+		return
+	}
+	if len(r.listed) == 0 {
+		return
+	}
+	fmt.Fprintf(r.Stdout, "%12s %12s %7s %8s %8s %s\n", "compressed", "uncompressed", "ratio", "alphabet", "max code", "name")
+	for _, e := range r.listed {
+		maxCode := "-"
+		if e.MaxCodeLength > 0 {
+			maxCode = fmt.Sprint(e.MaxCodeLength)
+		}
+		fmt.Fprintf(r.Stdout, "%12d %12d %6.1f%% %8d %8s %s\n", e.Compressed, e.Uncompressed, e.Ratio, e.AlphabetSize, maxCode, e.Name)
+	}
+	if len(r.listed) > 1 {
+		fmt.Fprintf(r.Stdout, "%12d %12d %6.1f%% %8s %8s %s\n", totals.Compressed, totals.Uncompressed, totals.Ratio, "", "", "(totals)")
+	}
+}
+
+// countReader counts the number of bytes read from the underlying io.Reader.
+type countReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *countReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	return n, err
+}
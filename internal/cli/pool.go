@@ -0,0 +1,98 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+)
+
+// runFiles processes the files, several at once with -T. Each file's
+// messages and output are held back until the files before it are done, so
+// they come out in the same order as without -T.
+func (r *run) runFiles(files []string) {
+	threads := r.threads
+	if threads == 0 {
+		threads = runtime.NumCPU()
+	}
+	if threads > len(files) {
+		threads = len(files)
+	}
+	if threads <= 1 || r.stdout || contains(files, "-") {
+		// Output to standard output is written as it goes rather than
+		// held in memory
+		for _, name := range files {
+			r.file(name)
+		}
+		return
+	}
+
+	if r.progress && isTerminal(r.Stderr) {
+		// This is only a notice, so it doesn't change the exit status
+		fmt.Fprintf(r.Stderr, "%s: --progress is ignored with more than one thread\n", r.Name)
+	}
+	jobs := make(chan int)
+	results := make([]*run, len(files))
+	done := make([]chan struct{}, len(files))
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+	for t := 0; t < threads; t++ {
+		go func() {
+			for i := range jobs {
+				jr := r.job()
+				jr.file(files[i])
+				results[i] = jr
+				close(done[i])
+			}
+		}()
+	}
+	go func() {
+		for i := range files {
+			jobs <- i
+		}
+		close(jobs)
+	}()
+	for i := range files {
+		<-done[i]
+		r.merge(results[i])
+	}
+}
+
+// job returns a run for processing one file on its own, with buffers for
+// its output and messages, and without progress, which can't be drawn on a
+// buffer.
+func (r *run) job() *run {
+	c := *r.Command
+	c.Stdout = new(bytes.Buffer)
+	c.Stderr = new(bytes.Buffer)
+	cfg := r.config
+	cfg.progress = false
+	return &run{Command: &c, config: cfg}
+}
+
+// merge adds the output, messages and results of a job to r.
+func (r *run) merge(jr *run) {
+	r.Stdout.Write(jr.Stdout.(*bytes.Buffer).Bytes())
+	r.Stderr.Write(jr.Stderr.(*bytes.Buffer).Bytes())
+	switch {
+	case jr.status == ExitError:
+		r.status = ExitError
+	case jr.status == ExitWarning && r.status == ExitOK:
+		r.status = ExitWarning
+	}
+	r.listed = append(r.listed, jr.listed...)
+	r.summary.done += jr.summary.done
+	r.summary.skipped += jr.summary.skipped
+	r.summary.failed += jr.summary.failed
+	r.summary.in += jr.summary.in
+	r.summary.out += jr.summary.out
+}
+
+func contains(list []string, s string) bool {
+	for _, t := range list {
+		if t == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,93 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/burakguven/hzip"
+)
+
+// progressOptions returns the options that show the progress of the named
+// file with --progress, and a function that clears the progress line once
+// the file is done. Progress is only shown if standard error is a terminal.
+func (r *run) progressOptions(name string) ([]hzip.Option, func()) {
+	if !r.progress || !isTerminal(r.Stderr) {
+		return nil, func() {}
+	}
+	bar := &progressBar{w: r.Stderr, name: name, now: time.Now}
+	return []hzip.Option{hzip.WithProgress(bar.update)}, bar.clear
+}
+
+// progressRedraw is how often the progress line is redrawn.
+const progressRedraw = 100 * time.Millisecond
+
+// A progressBar shows the progress of a file on a single line that it
+// redraws, with the amount done, the throughput and the estimated time left.
+type progressBar struct {
+	w     io.Writer
+	name  string
+	now   func() time.Time
+	start time.Time
+	last  time.Time // when the line was last drawn
+	shown bool
+}
+
+func (p *progressBar) update(done, total int64) {
+	now := p.now()
+	if p.start.IsZero() {
+		p.start = now
+	}
+	if p.shown && done < total && now.Sub(p.last) < progressRedraw {
+		return
+	}
+	p.last = now
+	p.shown = true
+	fmt.Fprintf(p.w, "\r\033[K%s", p.line(done, total, now.Sub(p.start)))
+}
+
+// line returns the progress line.
+func (p *progressBar) line(done, total int64, elapsed time.Duration) string {
+	percent := 100.0
+	if total > 0 {
+		percent = 100 * float64(done) / float64(total)
+	}
+	s := fmt.Sprintf("%s: %3.0f%% %s / %s", p.name, percent, formatBytes(done), formatBytes(total))
+	if done > 0 && elapsed > 0 {
+		rate := float64(done) / elapsed.Seconds()
+		left := time.Duration(float64(total-done) / rate * float64(time.Second))
+		s += fmt.Sprintf(", %s/s, ETA %s", formatBytes(int64(rate)), formatDuration(left))
+	}
+	return s
+}
+
+// clear erases the progress line.
+func (p *progressBar) clear() {
+	if p.shown {
+		fmt.Fprint(p.w, "\r\033[K")
+	}
+}
+
+// formatBytes formats a number of bytes with a binary prefix.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	value, prefix := float64(n)/unit, 0
+	for value >= unit && prefix < 4 {
+		value /= unit
+		prefix++
+	}
+	return fmt.Sprintf("%.1f %ciB", value, "KMGTP"[prefix])
+}
+
+// formatDuration formats a duration as minutes and seconds, or hours,
+// minutes and seconds.
+func formatDuration(d time.Duration) string {
+	s := int64((d + time.Second/2) / time.Second)
+	if s >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", s/3600, s/60%60, s%60)
+	}
+	return fmt.Sprintf("%d:%02d", s/60, s%60)
+}
@@ -0,0 +1,73 @@
+package cli
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProgressBar(t *testing.T) {
+	buf := new(bytes.Buffer)
+	now := time.Unix(0, 0)
+	bar := &progressBar{w: buf, name: "big.iso", now: func() time.Time { return now }}
+
+	bar.update(0, 100<<20)
+	assert.Equal(t, "\r\033[Kbig.iso:   0% 0 B / 100.0 MiB", buf.String())
+
+	// Too soon to redraw
+	buf.Reset()
+	now = now.Add(50 * time.Millisecond)
+	bar.update(1<<20, 100<<20)
+	assert.Empty(t, buf.String())
+
+	buf.Reset()
+	now = now.Add(1950 * time.Millisecond)
+	bar.update(25<<20, 100<<20)
+	assert.Equal(t, "\r\033[Kbig.iso:  25% 25.0 MiB / 100.0 MiB, 12.5 MiB/s, ETA 0:06", buf.String())
+
+	// The end is always drawn
+	buf.Reset()
+	bar.update(100<<20, 100<<20)
+	assert.Equal(t, "\r\033[Kbig.iso: 100% 100.0 MiB / 100.0 MiB, 50.0 MiB/s, ETA 0:00", buf.String())
+
+	buf.Reset()
+	bar.clear()
+	assert.Equal(t, "\r\033[K", buf.String())
+}
+
+func TestFormat(t *testing.T) {
+	assert.Equal(t, "0 B", formatBytes(0))
+	assert.Equal(t, "1023 B", formatBytes(1023))
+	assert.Equal(t, "1.0 KiB", formatBytes(1024))
+	assert.Equal(t, "1.5 GiB", formatBytes(3<<29))
+	assert.Equal(t, "0:00", formatDuration(0))
+	assert.Equal(t, "1:05", formatDuration(65*time.Second))
+	assert.Equal(t, "2:00:01", formatDuration(2*time.Hour+time.Second))
+}
+
+func TestProgressNotTerminal(t *testing.T) {
+	// Standard error isn't a terminal, so there's no progress
+	status, _, stderr := runCommand(false, []byte("data"), "--progress")
+	assert.Equal(t, ExitOK, status)
+	assert.Empty(t, stderr)
+}
+
+func TestProgressThreads(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	a, b := filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")
+	writeFile(t, a, "Hello")
+	writeFile(t, b, "World")
+
+	defer func(f func(interface{}) bool) { isTerminal = f }(isTerminal)
+	isTerminal = func(interface{}) bool { return true }
+	status, _, stderr := runCommand(false, nil, "--progress", "-T", "2", a, b)
+	assert.Equal(t, ExitOK, status)
+	assert.Equal(t, "hzip: --progress is ignored with more than one thread\n", stderr)
+	assert.True(t, exists(a+".hz"))
+	assert.True(t, exists(b+".hz"))
+}
@@ -0,0 +1,185 @@
+package cli
+
+import (
+	"archive/tar"
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/burakguven/hzip"
+)
+
+// runTar runs hzip tar, which writes a compressed tar archive to standard
+// output, or extracts one from standard input.
+func (c *Command) runTar(args []string) int {
+	var create, extract bool
+	var dir string
+	r := &run{Command: c}
+	fs := flag.NewFlagSet(c.Name+" tar", flag.ContinueOnError)
+	fs.SetOutput(c.Stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(c.Stderr, "usage: %s tar -c [flags] file ... > archive.tar.hz\n", c.Name)
+		fmt.Fprintf(c.Stderr, "       %s tar -x [flags] < archive.tar.hz\n", c.Name)
+		fs.PrintDefaults()
+	}
+	boolFlag(fs, &create, "c", "create", "write an archive with the given files and directories to standard output")
+	boolFlag(fs, &extract, "x", "extract", "extract the archive on standard input")
+	stringFlag(fs, &dir, "C", "directory", ".", "extract the files into `dir`")
+	boolFlag(fs, &r.force, "f", "force", "overwrite existing files and write compressed data to a terminal")
+
+	files, err := parseArgs(fs, args)
+	if err == flag.ErrHelp {
+		return ExitOK
+	} else if err != nil {
+		return ExitError
+	}
+	switch {
+	case create && !extract && len(files) > 0:
+		r.createTar(files)
+	case extract && !create && len(files) == 0:
+		r.extractTar(dir)
+	default:
+		fs.Usage()
+		return ExitError
+	}
+	return r.status
+}
+
+// maxTarSize is the largest tar archive that hzip tar can write. The whole
+// archive is compressed at once, in memory, and the size of an hzip file has to
+// fit in 32 bits. It's a variable so that tests can lower it.
+var maxTarSize int64 = math.MaxUint32
+
+// createTar writes a compressed tar archive of the given files and the
+// contents of the given directories to standard output.
+func (r *run) createTar(files []string) {
+	if isTerminal(r.Stdout) && !r.force {
+		r.errorf("compressed data not written to a terminal. Use -f to force compression.")
+		return
+	}
+	entries := r.collect(files, nil)
+	if r.status == ExitError {
+		return
+	}
+	if n := tarSize(entries); n > maxTarSize {
+		r.errorf("a tar archive of %s is too large to compress; use %s ar instead", formatBytes(n), r.Name)
+		return
+	}
+	bw := bufio.NewWriter(r.Stdout)
+	hw := hzip.NewWriter(bw, hzip.WithChecksum())
+	tw := tar.NewWriter(hw)
+	for _, e := range entries {
+		if err := addToTar(tw, e); err != nil {
+			r.fileError(e.path, err)
+			return
+		}
+	}
+	err := tw.Close()
+	if err == nil {
+		err = hw.Close()
+	}
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err != nil {
+		r.fileError("stdout", err)
+	}
+}
+
+// tarSize returns about how many bytes a tar archive of the entries takes: a
+// header block for each one, the contents of the files padded to whole blocks
+// and two empty blocks at the end. Long names take more blocks, which the
+// hzip.Writer catches when it's closed.
+func tarSize(entries []archiveEntry) int64 {
+	const block = 512
+	n := int64(2 * block)
+	for _, e := range entries {
+		n += block
+		if !e.fi.IsDir() {
+			n += (e.fi.Size() + block - 1) / block * block
+		}
+	}
+	return n
+}
+
+// addToTar adds a file or directory to a tar archive.
+func addToTar(tw *tar.Writer, e archiveEntry) error {
+	h, err := tar.FileInfoHeader(e.fi, "")
+	if err != nil {
+		return err
+	}
+	h.Name = e.name
+	if e.fi.IsDir() {
+		h.Name += "/"
+	}
+	if err := tw.WriteHeader(h); err != nil || e.fi.IsDir() {
+		return err
+	}
+	f, err := os.Open(e.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// extractTar extracts the compressed tar archive on standard input into dir.
+func (r *run) extractTar(dir string) {
+	if isTerminal(r.Stdin) && !r.force {
+		r.errorf("compressed data not read from a terminal. Use -f to force decompression.")
+		return
+	}
+	hr, err := hzip.NewReader(bufio.NewReader(r.Stdin))
+	if err != nil {
+		r.fileError("stdin", err)
+		return
+	}
+	tr := tar.NewReader(hr)
+	var dirs []extractedDir
+	defer func() { r.finishDirs(dirs) }()
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			r.fileError("stdin", err)
+			return
+		}
+		name := path.Clean(strings.TrimLeft(h.Name, "/"))
+		if name == "." {
+			continue
+		}
+		if name == ".." || strings.HasPrefix(name, "../") {
+			r.warnf("%s is outside the current directory -- ignored", h.Name)
+			continue
+		}
+		target := filepath.Join(dir, filepath.FromSlash(name))
+		fi := h.FileInfo()
+		switch h.Typeflag {
+		case tar.TypeDir:
+			if r.extractDir(target, fi.Mode()) {
+				dirs = append(dirs, extractedDir{target, fi})
+			}
+		case tar.TypeReg, tar.TypeRegA:
+			r.extractFile(target, fi, func(w io.Writer) error {
+				_, err := io.Copy(w, tr)
+				return err
+			})
+		default:
+			r.warnf("%s is not a directory or a regular file -- ignored", h.Name)
+		}
+	}
+	// Read up to the end of the compressed data, which checks the checksum
+	if _, err := io.Copy(ioutil.Discard, hr); err != nil {
+		r.fileError("stdin", err)
+	}
+}
@@ -0,0 +1,135 @@
+package cli
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/burakguven/hzip"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTar(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	mtime := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+	if err := os.MkdirAll(filepath.Join(dir, "src", "sub"), 0750); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "src", "a.txt"), "Hello World")
+	writeFile(t, filepath.Join(dir, "src", "sub", "b.txt"), strings.Repeat("abc", 1000))
+	if err := os.Chmod(filepath.Join(dir, "src", "a.txt"), 0604); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"src/a.txt", "src/sub/b.txt", "src/sub", "src"} {
+		if err := os.Chtimes(filepath.Join(dir, name), mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+
+	status, archive, stderr := runCommand(false, nil, "tar", "-c", "src")
+	assert.Equal(t, ExitOK, status, stderr)
+
+	// The output is a tar archive compressed with hzip
+	hr, err := hzip.NewReader(strings.NewReader(archive))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(hr)
+	var names []string
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, h.Name)
+	}
+	assert.Equal(t, []string{"src/", "src/a.txt", "src/sub/", "src/sub/b.txt"}, names)
+
+	status, _, stderr = runCommand(false, []byte(archive), "tar", "-x", "-C", "dst")
+	assert.Equal(t, ExitOK, status, stderr)
+	assert.Equal(t, "Hello World", readFile(t, "dst/src/a.txt"))
+	assert.Equal(t, strings.Repeat("abc", 1000), readFile(t, "dst/src/sub/b.txt"))
+	for name, perm := range map[string]os.FileMode{"dst/src/a.txt": 0604, "dst/src/sub": 0750, "dst/src": 0750} {
+		fi, err := os.Stat(name)
+		if assert.NoError(t, err) {
+			assert.Equal(t, perm, fi.Mode().Perm(), name)
+			assert.True(t, mtime.Equal(fi.ModTime()), "%s: %v", name, fi.ModTime())
+		}
+	}
+
+	// Existing files aren't overwritten without -f
+	writeFile(t, "dst/src/a.txt", "changed")
+	status, _, stderr = runCommand(false, []byte(archive), "tar", "-xC", "dst")
+	assert.Equal(t, ExitWarning, status)
+	assert.Contains(t, stderr, "a.txt already exists; not overwritten\n")
+	assert.Equal(t, "changed", readFile(t, "dst/src/a.txt"))
+	status, _, stderr = runCommand(false, []byte(archive), "tar", "-xfC", "dst")
+	assert.Equal(t, ExitOK, status, stderr)
+	assert.Equal(t, "Hello World", readFile(t, "dst/src/a.txt"))
+}
+
+func TestTarUnsafeNames(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	buf := new(bytes.Buffer)
+	hw := hzip.NewWriter(buf)
+	tw := tar.NewWriter(hw)
+	for _, name := range []string{"../evil.txt", "/abs.txt", "ok.txt"} {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: 2, Typeflag: tar.TypeReg})
+		tw.Write([]byte("hi"))
+	}
+	tw.WriteHeader(&tar.Header{Name: "link", Linkname: "/etc/passwd", Typeflag: tar.TypeSymlink})
+	tw.Close()
+	hw.Close()
+
+	status, _, stderr := runCommand(false, buf.Bytes(), "tar", "-x", "-C", dir)
+	assert.Equal(t, ExitWarning, status)
+	assert.Equal(t, "hzip: ../evil.txt is outside the current directory -- ignored\n"+
+		"hzip: link is not a directory or a regular file -- ignored\n", stderr)
+	assert.Equal(t, []string{"abs.txt", "ok.txt"}, dirNames(t, dir))
+	assert.False(t, exists(filepath.Join(dir, "..", "evil.txt")))
+}
+
+func TestTarErrors(t *testing.T) {
+	status, _, stderr := runCommand(false, nil, "tar", "-c")
+	assert.Equal(t, ExitError, status)
+	assert.Contains(t, stderr, "usage: hzip tar")
+
+	status, _, stderr = runCommand(false, nil, "tar", "-x", "file")
+	assert.Equal(t, ExitError, status)
+	assert.Contains(t, stderr, "usage: hzip tar")
+
+	status, _, stderr = runCommand(false, []byte("garbage"), "tar", "-x")
+	assert.Equal(t, ExitError, status)
+	assert.Equal(t, "hzip: stdin: unexpected EOF\n", stderr)
+
+	status, _, stderr = runCommand(false, nil, "tar", "-c", "missing")
+	assert.Equal(t, ExitError, status)
+	assert.Equal(t, "hzip: missing: no such file or directory\n", stderr)
+}
+
+func TestTarTooLarge(t *testing.T) {
+	defer func(n int64) { maxTarSize = n }(maxTarSize)
+	maxTarSize = 4096
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	writeFile(t, filepath.Join(dir, "big"), strings.Repeat("x", 4096))
+
+	status, stdout, stderr := runCommand(false, nil, "tar", "-c", filepath.Join(dir, "big"))
+	assert.Equal(t, ExitError, status)
+	assert.Equal(t, "hzip: a tar archive of 5.5 KiB is too large to compress; use hzip ar instead\n", stderr)
+	assert.Empty(t, stdout)
+}
@@ -0,0 +1,44 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// verifyFile tests the integrity of the named compressed file.
+func (r *run) verifyFile(name string) {
+	f, err := os.Open(name)
+	if err != nil {
+		r.fileError(name, err)
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		r.fileError(name, err)
+		return
+	}
+	if !fi.Mode().IsRegular() {
+		r.warnf("%s is not a regular file -- ignored", name)
+		return
+	}
+	r.verify(name, f)
+}
+
+// verify decompresses everything from src and throws it away, which checks
+// the header, that the data decodes to as many bytes as the header says, and
+// the checksum if there is one. It reports whether the file is OK on
+// standard output.
+func (r *run) verify(name string, src io.Reader) {
+	opts, clear := r.progressOptions(name)
+	err := decompress(ioutil.Discard, src, opts...)
+	clear()
+	if err == nil {
+		fmt.Fprintf(r.Stdout, "%s: OK\n", name)
+		return
+	}
+	fmt.Fprintf(r.Stdout, "%s: FAILED\n", name)
+	r.fileError(name, err)
+}
@@ -0,0 +1,137 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// expand returns the files to process, which are the given files with any
+// directories replaced by the files in them when recursing.
+func (r *run) expand(files []string) []string {
+	if !r.recursive {
+		return files
+	}
+	var expanded []string
+	for _, name := range files {
+		if fi, err := os.Lstat(name); err == nil && fi.IsDir() {
+			expanded = r.walk(expanded, name)
+		} else {
+			expanded = append(expanded, name)
+		}
+	}
+	return expanded
+}
+
+// walk appends every regular file in the directory tree rooted at dir to
+// files. Compressing skips files that already have the suffix, and everything
+// else skips files that don't have it. Symbolic links, special files and
+// files that don't match the include and exclude patterns are skipped too,
+// without a warning.
+func (r *run) walk(files []string, dir string) []string {
+	filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			r.fileError(path, err)
+			r.summary.failed++
+			return nil
+		}
+		if fi.IsDir() {
+			return nil
+		}
+		compressed := strings.HasSuffix(path, r.suffix)
+		wantCompressed := r.decompress || r.test || r.list
+		if !fi.Mode().IsRegular() || compressed != wantCompressed || !r.matches(fi.Name()) {
+			r.summary.skipped++
+			return nil
+		}
+		files = append(files, path)
+		return nil
+	})
+	return files
+}
+
+// matches reports whether a file name matches the include patterns, if there
+// are any, and none of the exclude patterns.
+func (r *run) matches(name string) bool {
+	if len(r.include) > 0 && !r.include.match(name) {
+		return false
+	}
+	return !r.exclude.match(name)
+}
+
+// patterns is a flag.Value for a list of filepath.Match patterns.
+type patterns []string
+
+func (p *patterns) String() string {
+	return strings.Join(*p, " ")
+}
+
+func (p *patterns) Set(pattern string) error {
+	*p = append(*p, pattern)
+	return nil
+}
+
+// check returns an error if any of the patterns are malformed.
+func (p patterns) check() error {
+	for _, pattern := range p {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("%s: %v", pattern, err)
+		}
+	}
+	return nil
+}
+
+func (p patterns) match(name string) bool {
+	for _, pattern := range p {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// A summary counts the files that were compressed or decompressed.
+type summary struct {
+	done, skipped, failed int
+	in, out               int64 // bytes read and written
+}
+
+func (s *summary) add(in, out int64) {
+	s.done++
+	s.in += in
+	s.out += out
+}
+
+// printSummary prints the summary of a recursive run.
+func (r *run) printSummary() {
+	s := r.summary
+	verb, compressed := "compressed", s.out
+	if r.decompress {
+		verb, compressed = "decompressed", s.in
+	}
+	uncompressed := s.in + s.out - compressed
+	fmt.Fprintf(r.Stderr, "%s: %s %d %s, %d -> %d bytes (%.1f%%), %d skipped, %d failed\n",
+		r.Name, verb, s.done, plural(s.done, "file", "files"), s.in, s.out,
+		ratio(compressed, uncompressed), s.skipped, s.failed)
+}
+
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
+
+// countWriter counts the number of bytes written to the underlying io.Writer.
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,91 @@
+package hzip
+
+import (
+	"context"
+	"strconv"
+)
+
+// An Option configures a Writer or a Reader. Options that only make sense for
+// one of them are ignored by the other.
+type Option func(*options)
+
+type options struct {
+	rle      bool
+	backend  Backend
+	ctx      context.Context
+	checksum bool
+	name     string
+	progress func(done, total int64)
+}
+
+func newOptions(opts []Option) options {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithRLE makes the Writer run-length encode its input before Huffman coding
+// it. Long runs of a repeated byte then cost a few bits instead of at least one
+// bit per byte. Readers detect run-length encoded data from the header.
+func WithRLE() Option {
+	return func(o *options) {
+		o.rle = true
+	}
+}
+
+// A Backend is the entropy coder that a Writer uses to compress the symbols.
+type Backend int
+
+const (
+	// Huffman coding is the default. It's the fastest backend.
+	Huffman Backend = iota
+	// Arithmetic coding compresses better than Huffman coding, especially
+	// when a few symbols make up most of the data, but it's slower.
+	Arithmetic
+	// TANS is table-based asymmetric numeral systems coding, which
+	// compresses almost as well as arithmetic coding at close to the speed
+	// of Huffman coding.
+	TANS
+)
+
+func (b Backend) String() string {
+	switch b {
+	case Huffman:
+		return "huffman"
+	case Arithmetic:
+		return "arithmetic"
+	case TANS:
+		return "tans"
+	}
+	return "Backend(" + strconv.Itoa(int(b)) + ")"
+}
+
+// WithBackend makes the Writer compress the symbols with the given backend.
+// Readers detect the backend from the header. Writers with a preset codebook
+// always use Huffman coding.
+func WithBackend(b Backend) Option {
+	return func(o *options) {
+		o.backend = b
+	}
+}
+
+// WithChecksum makes the Writer store a CRC-32 checksum of the data in the
+// header. Readers verify the checksum once they've read all of the data, and
+// return an error instead of io.EOF if it doesn't match, which catches
+// corruption that decoding alone can miss.
+func WithChecksum() Option {
+	return func(o *options) {
+		o.checksum = true
+	}
+}
+
+// WithName makes the Writer store the name of the original file in the header,
+// where it can be read from Reader.Header. The name can be up to 65535 bytes
+// long.
+func WithName(name string) Option {
+	return func(o *options) {
+		o.name = name
+	}
+}
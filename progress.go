@@ -0,0 +1,54 @@
+package hzip
+
+// progressInterval is the number of bytes or symbols between progress
+// reports.
+const progressInterval = 1 << 20
+
+// WithProgress makes the Writer and the Reader call fn as they go, with the
+// number of bytes (or symbols, for a SymbolWriter or SymbolReader) that have
+// been compressed or decompressed so far and the total number there are. The
+// Writer does its work in Close, which calls fn while it compresses the data.
+// The Reader knows the total from the header, and calls fn from Read. In both
+// cases, fn is called at the start, about every megabyte, and at the end.
+func WithProgress(fn func(done, total int64)) Option {
+	return func(o *options) {
+		o.progress = fn
+	}
+}
+
+// progress reports progress to a callback every progressInterval steps. The
+// zero value doesn't report anything.
+type progress struct {
+	fn                    func(done, total int64)
+	done, total, reported int64
+}
+
+// start reports that nothing has been done yet.
+func (p *progress) start(total int64) {
+	if p.fn == nil {
+		return
+	}
+	p.total = total
+	p.fn(0, total)
+}
+
+// add adds n to the amount done, and reports it if it's time to.
+func (p *progress) add(n int64) {
+	if p.fn == nil {
+		return
+	}
+	p.done += n
+	if p.done-p.reported >= progressInterval {
+		p.reported = p.done
+		p.fn(p.done, p.total)
+	}
+}
+
+// finish reports the final amount done, unless that's already been reported.
+func (p *progress) finish() {
+	if p.fn == nil || p.reported == p.done {
+		return
+	}
+	p.reported = p.done
+	p.fn(p.done, p.total)
+}
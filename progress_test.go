@@ -0,0 +1,70 @@
+package hzip
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type progressReport struct {
+	done, total int64
+}
+
+func TestProgress(t *testing.T) {
+	data := make([]byte, 3*progressInterval+100)
+	copy(data, genRandBytes(1000))
+	for _, opts := range [][]Option{nil, {WithRLE()}, {WithBackend(TANS)}} {
+		var reports []progressReport
+		record := WithProgress(func(done, total int64) {
+			reports = append(reports, progressReport{done, total})
+		})
+		buf := new(bytes.Buffer)
+		w := NewWriter(buf, append(opts, record)...)
+		w.Write(data)
+		assert.Empty(t, reports)
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		n := int64(len(data))
+		if len(opts) == 0 {
+			assert.Equal(t, []progressReport{
+				{0, n}, {progressInterval, n}, {2 * progressInterval, n}, {3 * progressInterval, n}, {n, n},
+			}, reports)
+		}
+		assert.Equal(t, progressReport{0, n}, reports[0])
+		assert.Equal(t, progressReport{n, n}, reports[len(reports)-1])
+
+		reports = nil
+		r, err := NewReader(bytes.NewReader(buf.Bytes()), record)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ioutil.ReadAll(r); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, progressReport{0, n}, reports[0])
+		assert.Equal(t, progressReport{n, n}, reports[len(reports)-1])
+		assert.True(t, len(reports) >= 4, "%d reports", len(reports))
+		for i := 1; i < len(reports); i++ {
+			assert.True(t, reports[i].done > reports[i-1].done)
+		}
+	}
+}
+
+func TestProgressEmpty(t *testing.T) {
+	var reports []progressReport
+	record := WithProgress(func(done, total int64) {
+		reports = append(reports, progressReport{done, total})
+	})
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf, record)
+	w.Close()
+	assert.Equal(t, []progressReport{{0, 0}}, reports)
+
+	reports = nil
+	r, _ := NewReader(bytes.NewReader(buf.Bytes()), record)
+	ioutil.ReadAll(r)
+	assert.Equal(t, []progressReport{{0, 0}}, reports)
+}
@@ -0,0 +1,50 @@
+package hzip
+
+// Run-length encoding extends the byte alphabet with escape symbols. Symbols
+// below 256 are literal bytes. The escape symbol runSymbol+k means "repeat the
+// previous byte 1<<k more times", so a run of any length is encoded as one
+// literal followed by at most one escape per set bit in the repeat count.
+const (
+	runSymbol = 0x100
+	maxRunLog = 32
+	// minRun is the shortest run that is worth replacing with escapes.
+	// Shorter runs are left as literals.
+	minRun = 4
+)
+
+// rleEncode converts p into a sequence of literal and escape symbols.
+func rleEncode(p []byte) []uint16 {
+	var syms []uint16
+	for i := 0; i < len(p); {
+		b := p[i]
+		n := 1
+		for i+n < len(p) && p[i+n] == b {
+			n++
+		}
+		i += n
+		if n < minRun {
+			for k := 0; k < n; k++ {
+				syms = append(syms, uint16(b))
+			}
+			continue
+		}
+		syms = append(syms, uint16(b))
+		// Encode the repeat count from the largest power of two down
+		repeat := uint64(n - 1)
+		for k := maxRunLog - 1; k >= 0; k-- {
+			if repeat&(1<<uint(k)) != 0 {
+				syms = append(syms, uint16(runSymbol+k))
+			}
+		}
+	}
+	return syms
+}
+
+// runLength returns the number of repeats encoded by the escape symbol sym,
+// and false if sym isn't an escape symbol.
+func runLength(sym uint16) (uint64, bool) {
+	if sym < runSymbol || sym >= runSymbol+maxRunLog {
+		return 0, false
+	}
+	return 1 << uint(sym-runSymbol), true
+}
@@ -0,0 +1,80 @@
+package hzip
+
+import "math"
+
+// Stats describes what a Writer did with its input.
+type Stats struct {
+	// InputSize is the number of bytes written to the Writer, or the
+	// number of symbols for a SymbolWriter.
+	InputSize int64
+	// OutputSize is the number of bytes written to the underlying
+	// io.Writer, including the header.
+	OutputSize int64
+	// HeaderSize is the number of bytes in the header.
+	HeaderSize int64
+	// Freqs is the frequency of each symbol that was coded. With WithRLE,
+	// these are the run-length encoded symbols rather than the input bytes.
+	Freqs map[uint16]int
+	// CodeLengths is the length of the codeword for each symbol. It's nil
+	// for backends other than Huffman coding, which don't assign whole
+	// codewords to symbols.
+	CodeLengths map[uint16]int
+	// Entropy is the Shannon entropy of the input in bits per byte or
+	// symbol, which is the best that any coder that looks at the symbols
+	// one at a time can do.
+	Entropy float64
+	// BitsPerSymbol is the number of bits of compressed data, not counting
+	// the header, per byte or symbol of input.
+	BitsPerSymbol float64
+}
+
+// Stats returns statistics about the compression. Everything but InputSize
+// and Entropy is only known after Close has been called.
+func (w *Writer) Stats() Stats {
+	s := Stats{
+		InputSize: int64(w.size()),
+		Freqs:     make(map[uint16]int, len(w.freqs)),
+	}
+	for sym, freq := range w.freqs {
+		s.Freqs[sym] = freq
+	}
+	if w.wide {
+		s.Entropy = entropy(w.freqs)
+	} else {
+		counts := make(map[uint16]int)
+		for b, n := range w.counts {
+			if n > 0 {
+				counts[uint16(b)] = n
+			}
+		}
+		s.Entropy = entropy(counts)
+	}
+	if w.cb != nil {
+		s.CodeLengths = w.cb.Lengths()
+	}
+	if w.closed {
+		s.OutputSize = w.cw.n
+		s.HeaderSize = w.header
+		if s.InputSize > 0 {
+			s.BitsPerSymbol = float64(8*(s.OutputSize-s.HeaderSize)) / float64(s.InputSize)
+		}
+	}
+	return s
+}
+
+// entropy returns the Shannon entropy of the given frequencies in bits per
+// symbol.
+func entropy(freqs map[uint16]int) float64 {
+	total := 0
+	for _, freq := range freqs {
+		total += freq
+	}
+	h := 0.0
+	for _, freq := range freqs {
+		if freq > 0 {
+			p := float64(freq) / float64(total)
+			h -= p * math.Log2(p)
+		}
+	}
+	return h
+}
@@ -0,0 +1,62 @@
+package hzip
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStats(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf)
+	io.WriteString(w, "aaaabbcd")
+	assert.Equal(t, int64(8), w.Stats().InputSize)
+	assert.Equal(t, int64(0), w.Stats().OutputSize)
+	assert.NoError(t, w.Close())
+
+	s := w.Stats()
+	assert.Equal(t, int64(8), s.InputSize)
+	assert.Equal(t, int64(buf.Len()), s.OutputSize)
+	// File size, alphabet size and 3 bytes of table for each symbol
+	assert.Equal(t, int64(8+4*3), s.HeaderSize)
+	assert.Equal(t, map[uint16]int{'a': 4, 'b': 2, 'c': 1, 'd': 1}, s.Freqs)
+	assert.Equal(t, map[uint16]int{'a': 1, 'b': 2, 'c': 3, 'd': 3}, s.CodeLengths)
+	// The codes match the probabilities exactly, so they reach the entropy
+	assert.InDelta(t, 1.75, s.Entropy, 1e-9)
+	// 14 bits of data padded to 2 bytes
+	assert.InDelta(t, 2.0, s.BitsPerSymbol, 1e-9)
+}
+
+func TestStatsBackends(t *testing.T) {
+	data := genRandBytes(10000)
+	for _, backend := range []Backend{Arithmetic, TANS} {
+		buf := new(bytes.Buffer)
+		w := NewWriter(buf, WithBackend(backend))
+		w.Write(data)
+		assert.NoError(t, w.Close())
+		s := w.Stats()
+		assert.Nil(t, s.CodeLengths)
+		assert.Equal(t, int64(buf.Len()), s.OutputSize)
+		assert.True(t, s.BitsPerSymbol >= s.Entropy, "%v < %v", s.BitsPerSymbol, s.Entropy)
+		assert.True(t, s.BitsPerSymbol < s.Entropy+0.1, "%v >= %v", s.BitsPerSymbol, s.Entropy+0.1)
+	}
+}
+
+func TestStatsRLE(t *testing.T) {
+	w := NewWriter(new(bytes.Buffer), WithRLE())
+	w.Write(make([]byte, 1000))
+	assert.NoError(t, w.Close())
+	s := w.Stats()
+	assert.Equal(t, int64(1000), s.InputSize)
+	assert.Equal(t, 0.0, s.Entropy)
+	// A zero byte followed by an escape for each bit of the 999 repeats
+	assert.Equal(t, map[uint16]int{
+		0: 1, runSymbol + 0: 1, runSymbol + 1: 1, runSymbol + 2: 1,
+		runSymbol + 5: 1, runSymbol + 6: 1, runSymbol + 7: 1,
+		runSymbol + 8: 1, runSymbol + 9: 1,
+	}, s.Freqs)
+	assert.False(t, math.IsNaN(s.BitsPerSymbol))
+}
@@ -0,0 +1,100 @@
+package hzip
+
+import (
+	"errors"
+	"io"
+)
+
+// MaxSymbols is the size of the largest alphabet that can be encoded with a
+// SymbolWriter. Symbols are values from 0 to MaxSymbols-1.
+const MaxSymbols = 1 << 16
+
+var errRLESymbols = errors.New("hzip: run-length encoded data can't be read as symbols")
+
+// A SymbolWriter compresses a sequence of symbols from an alphabet of up to
+// MaxSymbols values, rather than a sequence of bytes. It's useful for
+// compressing the output of other coding stages, such as LZ lengths or 16-bit
+// samples.
+type SymbolWriter struct {
+	w *Writer
+}
+
+// NewSymbolWriter returns a SymbolWriter that writes compressed symbols to
+// the given io.Writer. The WithRLE option is ignored.
+//
+// No data is written to the underlying io.Writer until Close is called.
+func NewSymbolWriter(w io.Writer, opts ...Option) *SymbolWriter {
+	hw := NewWriter(w, opts...)
+	hw.wide = true
+	return &SymbolWriter{w: hw}
+}
+
+// WriteSymbols adds the symbols in p to the data to be compressed.
+func (w *SymbolWriter) WriteSymbols(p []uint16) (int, error) {
+	for _, sym := range p {
+		w.w.freqs[sym]++
+		w.w.syms = append(w.w.syms, sym)
+	}
+	return len(p), nil
+}
+
+// Close writes the compressed symbols to the underlying io.Writer. It does
+// not close the underlying io.Writer.
+func (w *SymbolWriter) Close() error {
+	return w.w.Close()
+}
+
+// A SymbolReader decompresses a sequence of symbols written by a
+// SymbolWriter. It can also read the output of a Writer that wasn't run-length
+// encoded, in which case every symbol is a byte.
+type SymbolReader struct {
+	r *Reader
+}
+
+// NewSymbolReader returns a SymbolReader that reads compressed symbols from
+// the given io.Reader.
+func NewSymbolReader(r io.Reader, opts ...Option) (*SymbolReader, error) {
+	hr, err := NewReader(r, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if hr.flags&flagRLE != 0 {
+		return nil, errRLESymbols
+	}
+	return &SymbolReader{r: hr}, nil
+}
+
+// ReadSymbols reads up to len(p) symbols into p. It returns the number of
+// symbols read and io.EOF once all of the symbols have been read.
+func (r *SymbolReader) ReadSymbols(p []uint16) (int, error) {
+	n, err := r.readSymbols(p)
+	r.r.progress.add(int64(n))
+	if err == io.EOF {
+		r.r.progress.finish()
+	}
+	if r.r.flags&flagCRC != 0 {
+		r.r.crc = updateSymbolCRC(r.r.crc, p[:n])
+		if err == io.EOF {
+			err = r.r.checkCRC()
+		}
+	}
+	return n, err
+}
+
+func (r *SymbolReader) readSymbols(p []uint16) (int, error) {
+	n := 0
+	for i := 0; i < len(p); i++ {
+		if r.r.nRead == r.r.fileSize {
+			r.r.discardPadding()
+			return n, io.EOF
+		}
+		sym, err := r.r.decode()
+		if err != nil {
+			return n, err
+		}
+		p[i] = sym
+		r.r.nRead++
+		n++
+	}
+	return n, nil
+}
@@ -0,0 +1,123 @@
+package hzip
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func readAllSymbols(t *testing.T, r *SymbolReader) []uint16 {
+	var syms []uint16
+	buf := make([]uint16, 100)
+	for {
+		n, err := r.ReadSymbols(buf)
+		syms = append(syms, buf[:n]...)
+		if err == io.EOF {
+			return syms
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSymbolsRoundTrip(t *testing.T) {
+	for _, alphabet := range []int{1, 2, 300, 5000, MaxSymbols} {
+		syms := make([]uint16, 2*alphabet)
+		for i := range syms {
+			syms[i] = uint16(rand.Intn(alphabet))
+		}
+		buf := new(bytes.Buffer)
+		w := NewSymbolWriter(buf)
+		if _, err := w.WriteSymbols(syms); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		r, err := NewSymbolReader(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, syms, readAllSymbols(t, r))
+	}
+}
+
+func TestSymbolsEmpty(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w := NewSymbolWriter(buf)
+	w.Close()
+	r, err := NewSymbolReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, readAllSymbols(t, r))
+}
+
+func TestReadBytesAsSymbols(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/hello.hz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewSymbolReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want []uint16
+	for _, b := range []byte("Hello World\n") {
+		want = append(want, uint16(b))
+	}
+	assert.Equal(t, want, readAllSymbols(t, r))
+
+	// Run-length encoded data can only be read as bytes
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf, WithRLE())
+	io.WriteString(w, "aaaaaaaa")
+	w.Close()
+	_, err = NewSymbolReader(bytes.NewReader(buf.Bytes()))
+	assert.Equal(t, errRLESymbols, err)
+}
+
+func TestReadSymbolsAsBytes(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w := NewSymbolWriter(buf)
+	w.WriteSymbols([]uint16{'a', 'b', 'c'})
+	w.Close()
+	assert.Nil(t, tryDecompress(t, buf.Bytes()))
+
+	buf.Reset()
+	w = NewSymbolWriter(buf)
+	w.WriteSymbols([]uint16{'a', 0x1234})
+	w.Close()
+	assert.Equal(t, errSymbol, tryDecompress(t, buf.Bytes()))
+}
+
+func TestSymbolsChecksum(t *testing.T) {
+	syms := []uint16{1, 1000, 2, 1000, 0xffff}
+	buf := new(bytes.Buffer)
+	w := NewSymbolWriter(buf, WithChecksum())
+	w.WriteSymbols(syms)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewSymbolReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, syms, readAllSymbols(t, r))
+
+	buf.Bytes()[8] ^= 0x01
+	r, err = NewSymbolReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := make([]uint16, 2)
+	for err == nil {
+		_, err = r.ReadSymbols(p)
+	}
+	assert.Equal(t, errCRC, err)
+}
@@ -0,0 +1,204 @@
+package hzip
+
+import "io"
+
+// Table-based asymmetric numeral systems (tANS), as in the FSE coder used by
+// zstd. The coder has a state from 0 to L-1, where L = 1<<log is the sum of
+// the normalized frequencies in the freqTable, and each symbol occupies as
+// many of the L states as its frequency. Decoding a symbol reads the symbol
+// from the state and a few bits from the input to get to the next state, so
+// it needs none of the range arithmetic of arithmetic coding, while spending a
+// fractional number of bits per symbol like it does.
+//
+// The encoder runs backwards, so it encodes the symbols in reverse and then
+// writes the bits in reverse order for the decoder to read them forwards:
+//	- log bits: the initial state of the decoder
+//	- For each symbol, 0 or more bits to get to the next state
+
+// minTANSLog is the smallest table log that the tANS coder uses. Larger
+// tables model the frequencies more accurately but take longer to build.
+const minTANSLog = 11
+
+// tansSpread assigns the states to the symbols in the table. The symbols are
+// spread out across the states, which makes the coding more efficient than
+// giving each symbol a contiguous range. It returns the index of the symbol
+// for each state.
+func tansSpread(t *freqTable) []int {
+	if len(t.syms) == 0 {
+		return nil
+	}
+	size := 1 << t.log
+	mask := size - 1
+	step := size>>1 + size>>3 + 3 // odd, so every state gets visited
+	spread := make([]int, size)
+	pos := 0
+	for i := range t.syms {
+		for k := uint32(0); k < t.freqs[i]; k++ {
+			spread[pos] = i
+			pos = (pos + step) & mask
+		}
+	}
+	return spread
+}
+
+type tansEncoder struct {
+	t *freqTable
+	// next[t.cum[i]+k] is the encoder state after encoding the symbol with
+	// index i, when the state shifted right by the number of bits written
+	// is t.freqs[i]+k.
+	next []uint32
+}
+
+func newTANSEncoder(t *freqTable) *tansEncoder {
+	size := uint32(1) << t.log
+	e := &tansEncoder{t: t, next: make([]uint32, size)}
+	seen := make([]uint32, len(t.syms))
+	for state, i := range tansSpread(t) {
+		e.next[t.cum[i]+seen[i]] = size + uint32(state)
+		seen[i]++
+	}
+	return e
+}
+
+// tansBits collects the bits written for the symbols, which are written out
+// in reverse order once all of them have been encoded. They're packed 8 to a
+// byte, so that holding them takes no more memory than the output does.
+type tansBits struct {
+	buf []byte
+	n   uint64 // number of bits in buf
+}
+
+// add adds the low n bits of v, least significant bit first, so that they come
+// out most significant bit first when they're written in reverse.
+func (b *tansBits) add(v uint32, n uint) {
+	for k := uint(0); k < n; k++ {
+		if b.n%8 == 0 {
+			b.buf = append(b.buf, 0)
+		}
+		b.buf[b.n/8] |= byte(v>>k&1) << (b.n % 8)
+		b.n++
+	}
+}
+
+// writeReverse writes the bits to w, last one first.
+func (b *tansBits) writeReverse(w *BitWriter) error {
+	for k := b.n; k > 0; k-- {
+		bit := b.buf[(k-1)/8] >> ((k - 1) % 8) & 1
+		if _, err := w.WriteBit('0' + bit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encode writes the given symbols, which must all be in the table.
+func (e *tansEncoder) encode(w *BitWriter, syms func(fn func(sym uint16) error) error) error {
+	if len(e.t.syms) == 0 {
+		// Nothing to encode
+		return nil
+	}
+	// The encoder state is offset by L, so it's from L to 2L-1
+	var (
+		size  = uint32(1) << e.t.log
+		state = size
+		bits  tansBits
+	)
+	err := syms(func(sym uint16) error {
+		i := e.t.index[sym]
+		freq := e.t.freqs[i]
+		nbits := uint(0)
+		for state>>nbits >= 2*freq {
+			nbits++
+		}
+		bits.add(state&(1<<nbits-1), nbits)
+		state = e.next[e.t.cum[i]+state>>nbits-freq]
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := writeBitsMSB(w, state-size, e.t.log); err != nil {
+		return err
+	}
+	return bits.writeReverse(w)
+}
+
+type tansDecoder struct {
+	t       *freqTable
+	sym     []uint16 // symbol for each state
+	nbits   []uint8  // number of bits to read in each state
+	base    []uint32 // next state before adding the bits read
+	state   uint32
+	started bool
+}
+
+func newTANSDecoder(t *freqTable) *tansDecoder {
+	size := uint32(1) << t.log
+	d := &tansDecoder{
+		t:     t,
+		sym:   make([]uint16, size),
+		nbits: make([]uint8, size),
+		base:  make([]uint32, size),
+	}
+	next := make([]uint32, len(t.syms))
+	copy(next, t.freqs)
+	for state, i := range tansSpread(t) {
+		x := next[i]
+		next[i]++
+		// Shift x up into the range from L to 2L-1
+		nbits := uint(0)
+		for x<<nbits < size {
+			nbits++
+		}
+		d.sym[state] = t.syms[i]
+		d.nbits[state] = uint8(nbits)
+		d.base[state] = x<<nbits - size
+	}
+	return d
+}
+
+func (d *tansDecoder) Decode(r *BitReader) (uint16, error) {
+	if len(d.t.syms) == 0 {
+		return 0, errFreqTable
+	}
+	if !d.started {
+		state, err := readBitsMSB(r, d.t.log)
+		if err != nil {
+			return 0, err
+		}
+		d.state = state
+		d.started = true
+	}
+	sym := d.sym[d.state]
+	bits, err := readBitsMSB(r, uint(d.nbits[d.state]))
+	if err != nil {
+		return 0, err
+	}
+	d.state = d.base[d.state] + bits
+	return sym, nil
+}
+
+// writeBitsMSB writes the low n bits of v, most significant bit first.
+func writeBitsMSB(w *BitWriter, v uint32, n uint) error {
+	for k := n; k > 0; k-- {
+		if _, err := w.WriteBit(byte('0' + v>>(k-1)&1)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readBitsMSB reads n bits written by writeBitsMSB.
+func readBitsMSB(r *BitReader, n uint) (uint32, error) {
+	var v uint32
+	for k := uint(0); k < n; k++ {
+		bit, err := r.ReadBit()
+		if err == io.EOF {
+			return 0, io.ErrUnexpectedEOF
+		} else if err != nil {
+			return 0, err
+		}
+		v = v<<1 | uint32(bit-'0')
+	}
+	return v, nil
+}
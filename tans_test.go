@@ -0,0 +1,143 @@
+package hzip
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTANSRoundTrip(t *testing.T) {
+	roundTrip(t, nil, WithBackend(TANS))
+	roundTrip(t, []byte("X"), WithBackend(TANS))
+	roundTrip(t, []byte("XXXXXXXXXX"), WithBackend(TANS))
+	roundTrip(t, []byte("Hello World"), WithBackend(TANS))
+	for i := 0; i < 300; i++ {
+		roundTrip(t, genRandBytes(i*7), WithBackend(TANS))
+	}
+	roundTrip(t, bytes.Repeat([]byte("aaaaaaaaaaaaaaab"), 1000), WithBackend(TANS), WithRLE())
+}
+
+func TestTANSSymbols(t *testing.T) {
+	for _, alphabet := range []int{300, 5000, MaxSymbols} {
+		syms := make([]uint16, 3*alphabet)
+		for i := range syms {
+			syms[i] = uint16(rand.Intn(alphabet))
+		}
+		buf := new(bytes.Buffer)
+		w := NewSymbolWriter(buf, WithBackend(TANS))
+		w.WriteSymbols(syms)
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		r, err := NewSymbolReader(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, syms, readAllSymbols(t, r))
+	}
+}
+
+func TestTANSSkewed(t *testing.T) {
+	data := make([]byte, 100000)
+	for i := range data {
+		if rand.Intn(100) == 0 {
+			data[i] = byte(rand.Intn(4))
+		}
+	}
+	huffman := roundTrip(t, data)
+	tans := roundTrip(t, data, WithBackend(TANS))
+	if len(tans) >= len(huffman)/2 {
+		t.Errorf("tANS gave %d bytes; want less than half of %d", len(tans), len(huffman))
+	}
+}
+
+func TestTANSTruncated(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf, WithBackend(TANS))
+	w.Write(genRandBytes(1000))
+	w.Close()
+	data := buf.Bytes()
+	assert.Equal(t, io.ErrUnexpectedEOF, tryDecompress(t, data[:len(data)-10]))
+}
+
+func TestTANSBits(t *testing.T) {
+	var b tansBits
+	b.add(0x5, 3)  // 101
+	b.add(0, 0)    // nothing
+	b.add(0x1, 4)  // 0001
+	b.add(0x2c, 6) // 101100
+	assert.Equal(t, 2, len(b.buf))
+
+	buf := new(bytes.Buffer)
+	w := NewBitWriter(buf)
+	if err := b.writeReverse(w); err != nil {
+		t.Fatal(err)
+	}
+	w.Flush()
+	// 101100 0001 101, padded with zeros
+	assert.Equal(t, []byte{0xb0, 0x68}, buf.Bytes())
+}
+
+// benchmarkData returns the uncompressed files in testdata, repeated to make
+// it large enough to measure.
+func benchmarkData(b *testing.B) []byte {
+	matches, err := filepath.Glob("testdata/*")
+	if err != nil {
+		b.Fatal(err)
+	}
+	var data []byte
+	for _, name := range matches {
+		if strings.HasSuffix(name, ".hz") {
+			continue
+		}
+		raw, err := ioutil.ReadFile(name)
+		if err != nil {
+			b.Fatal(err)
+		}
+		data = append(data, raw...)
+	}
+	return bytes.Repeat(data, 1<<16/len(data)+1)
+}
+
+func benchmarkCompress(b *testing.B, opts ...Option) {
+	data := benchmarkData(b)
+	b.SetBytes(int64(len(data)))
+	buf := new(bytes.Buffer)
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		w := NewWriter(buf, opts...)
+		w.Write(data)
+		w.Close()
+	}
+	b.Logf("ratio %.4f", float64(buf.Len())/float64(len(data)))
+}
+
+func benchmarkDecompress(b *testing.B, opts ...Option) {
+	data := benchmarkData(b)
+	b.SetBytes(int64(len(data)))
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf, opts...)
+	w.Write(data)
+	w.Close()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r, err := NewReader(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			b.Fatal(err)
+		}
+		io.Copy(ioutil.Discard, r)
+	}
+}
+
+func BenchmarkCompressHuffman(b *testing.B)      { benchmarkCompress(b) }
+func BenchmarkCompressArithmetic(b *testing.B)   { benchmarkCompress(b, WithBackend(Arithmetic)) }
+func BenchmarkCompressTANS(b *testing.B)         { benchmarkCompress(b, WithBackend(TANS)) }
+func BenchmarkDecompressHuffman(b *testing.B)    { benchmarkDecompress(b) }
+func BenchmarkDecompressArithmetic(b *testing.B) { benchmarkDecompress(b, WithBackend(Arithmetic)) }
+func BenchmarkDecompressTANS(b *testing.B)       { benchmarkDecompress(b, WithBackend(TANS)) }
@@ -1,23 +1,38 @@
 package hzip
 
-import "container/heap"
+import (
+	"bytes"
+	"container/heap"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
 
 type node struct {
-	val         byte
+	val         uint16
 	freq        int
+	depth       int    // height of the subtree, used to break ties
+	min         uint16 // smallest symbol in the subtree, used to break ties
 	left, right *node
 }
 
 // buildTree builds a Huffman coding tree based on the given symbol frequencies
 // and returns a pointer to the root node.
-func buildTree(freqs map[byte]int) *node {
+//
+// The tree only depends on the frequencies, so the same input always gives
+// the same codes. When two trees have the same frequency, the shallower one is
+// combined first, which keeps the longest code as short as possible, and
+// after that the one with the smallest symbol.
+func buildTree(freqs map[uint16]int) *node {
 	if len(freqs) == 0 {
 		return nil
 	}
 	nodes := new(nodeHeap)
 	// Start with a forest of nodes, each node being one symbol in the alphabet
 	for val, freq := range freqs {
-		heap.Push(nodes, node{val: val, freq: freq})
+		heap.Push(nodes, node{val: val, freq: freq, min: val})
 	}
 	// Combine the two trees with the lowest frequency until only one tree left
 	for len(*nodes) > 1 {
@@ -25,9 +40,17 @@ func buildTree(freqs map[byte]int) *node {
 		b := heap.Pop(nodes).(node)
 		parent := node{
 			freq:  a.freq + b.freq,
+			depth: a.depth + 1,
+			min:   a.min,
 			left:  &a,
 			right: &b,
 		}
+		if b.depth >= a.depth {
+			parent.depth = b.depth + 1
+		}
+		if b.min < a.min {
+			parent.min = b.min
+		}
 		heap.Push(nodes, parent)
 	}
 	root := heap.Pop(nodes).(node)
@@ -37,14 +60,14 @@ func buildTree(freqs map[byte]int) *node {
 // buildCodeMap builds a Huffman coding map, mapping from the input symbol to
 // the symbol encoding, which is represented as a string of ASCII '1' and '0'
 // characters.
-func buildCodeMap(freqs map[byte]int) map[byte]string {
+func buildCodeMap(freqs map[uint16]int) map[uint16]string {
 	root := buildTree(freqs)
-	codes := make(map[byte]string)
+	codes := make(map[uint16]string)
 	buildCodeMapRec(root, "", &codes)
 	return codes
 }
 
-func buildCodeMapRec(n *node, code string, codes *map[byte]string) {
+func buildCodeMapRec(n *node, code string, codes *map[uint16]string) {
 	if n == nil {
 		return
 	}
@@ -56,13 +79,98 @@ func buildCodeMapRec(n *node, code string, codes *map[byte]string) {
 	}
 }
 
+// WriteTreeDOT writes the Huffman coding tree for the given symbol
+// frequencies to w in the Graphviz DOT language. Each leaf shows its symbol,
+// frequency and codeword, and each edge is labelled with its bit. The tree is
+// the one that NewCodebook builds its codes from.
+func WriteTreeDOT(w io.Writer, freqs map[uint16]int) error {
+	var b bytes.Buffer
+	b.WriteString("digraph huffman {\n")
+	writeTreeDOTRec(&b, buildTree(freqs), "")
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeTreeDOTRec(b *bytes.Buffer, n *node, code string) {
+	if n == nil {
+		return
+	}
+	if n.left == nil && n.right == nil {
+		label := fmt.Sprintf("%s\n%d\n%s", symbolLabel(n.val), n.freq, code)
+		fmt.Fprintf(b, "\tn%s [shape=box, label=%s];\n", code, dotQuote(label))
+		return
+	}
+	fmt.Fprintf(b, "\tn%s [shape=circle, label=\"%d\"];\n", code, n.freq)
+	fmt.Fprintf(b, "\tn%s -> n%s0 [label=\"0\"];\n", code, code)
+	fmt.Fprintf(b, "\tn%s -> n%s1 [label=\"1\"];\n", code, code)
+	writeTreeDOTRec(b, n.left, code+"0")
+	writeTreeDOTRec(b, n.right, code+"1")
+}
+
+// symbolLabel returns a printable name for a symbol: the character itself
+// for printable ASCII, and its value in hex otherwise.
+func symbolLabel(sym uint16) string {
+	if sym < 0x80 && strconv.IsPrint(rune(sym)) {
+		return string(rune(sym))
+	}
+	return fmt.Sprintf("0x%02x", sym)
+}
+
+// dotQuote quotes s as a DOT string, where newlines are written as \n.
+func dotQuote(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+	return `"` + s + `"`
+}
+
+// A jsonNode is a node of the tree as written by WriteTreeJSON.
+type jsonNode struct {
+	Symbol *uint16   `json:"symbol,omitempty"`
+	Freq   int       `json:"freq"`
+	Code   string    `json:"code"`
+	Left   *jsonNode `json:"left,omitempty"`
+	Right  *jsonNode `json:"right,omitempty"`
+}
+
+// WriteTreeJSON writes the Huffman coding tree for the given symbol
+// frequencies to w as JSON. Each node is an object with its frequency and
+// codeword, which is the path to the node from the root. Leaves also have the
+// symbol, and other nodes have the left (0) and right (1) subtrees. An empty
+// tree is written as null.
+func WriteTreeJSON(w io.Writer, freqs map[uint16]int) error {
+	return json.NewEncoder(w).Encode(newJSONNode(buildTree(freqs), ""))
+}
+
+func newJSONNode(n *node, code string) *jsonNode {
+	if n == nil {
+		return nil
+	}
+	jn := &jsonNode{Freq: n.freq, Code: code}
+	if n.left == nil && n.right == nil {
+		sym := n.val
+		jn.Symbol = &sym
+		return jn
+	}
+	jn.Left = newJSONNode(n.left, code+"0")
+	jn.Right = newJSONNode(n.right, code+"1")
+	return jn
+}
+
 type nodeHeap []node
 
 // Implement heap.Interface
 
-func (h nodeHeap) Len() int           { return len(h) }
-func (h nodeHeap) Less(i, j int) bool { return h[i].freq < h[j].freq }
-func (h nodeHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h nodeHeap) Len() int { return len(h) }
+func (h nodeHeap) Less(i, j int) bool {
+	if h[i].freq != h[j].freq {
+		return h[i].freq < h[j].freq
+	}
+	if h[i].depth != h[j].depth {
+		return h[i].depth < h[j].depth
+	}
+	return h[i].min < h[j].min
+}
+func (h nodeHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
 func (h *nodeHeap) Push(x interface{}) {
 	*h = append(*h, x.(node))
 }
@@ -1,6 +1,7 @@
 package hzip
 
 import (
+	"bytes"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -11,28 +12,28 @@ func TestBuildTree(t *testing.T) {
 	root = buildTree(nil)
 	assert.Nil(t, root)
 
-	root = buildTree(map[byte]int{0x12: 5})
-	assert.Equal(t, byte(0x12), root.val)
+	root = buildTree(map[uint16]int{0x12: 5})
+	assert.Equal(t, uint16(0x12), root.val)
 	assert.Equal(t, 5, root.freq)
 	assert.Nil(t, root.left)
 	assert.Nil(t, root.right)
 }
 
 func TestBuildCodeMapBase(t *testing.T) {
-	var codes map[byte]string
+	var codes map[uint16]string
 	codes = buildCodeMap(nil)
 	assert.Empty(t, codes)
 
-	codes = buildCodeMap(map[byte]int{0x12: 5})
+	codes = buildCodeMap(map[uint16]int{0x12: 5})
 	assert.Equal(t, 1, len(codes))
 	assert.Equal(t, "", codes[0x12])
 }
 
 func TestBuildCodeMap(t *testing.T) {
-	freqs := map[byte]int{
+	freqs := map[uint16]int{
 		'A': 6, 'B': 4, 'C': 5, 'G': 1, 'H': 2,
 	}
-	wantCodes := map[byte]string{
+	wantCodes := map[uint16]string{
 		'A': "11", 'B': "01", 'C': "10", 'G': "000", 'H': "001",
 	}
 	codes := buildCodeMap(freqs)
@@ -41,7 +42,69 @@ func TestBuildCodeMap(t *testing.T) {
 	}
 	for sym := range codes {
 		if codes[sym] != wantCodes[sym] {
-			t.Errorf("codes[%q] == %q; want %q", sym, codes[sym], wantCodes[sym])
+			t.Errorf("codes[%q] == %q; want %q", rune(sym), codes[sym], wantCodes[sym])
 		}
 	}
 }
+
+func TestBuildCodeMapTies(t *testing.T) {
+	// Every symbol has the same frequency, so only the tie-breaking rules
+	// decide the codes
+	freqs := map[uint16]int{
+		'A': 1, 'B': 1, 'C': 1, 'D': 1, 'E': 1,
+	}
+	wantCodes := map[uint16]string{
+		'A': "110", 'B': "111", 'C': "00", 'D': "01", 'E': "10",
+	}
+	for i := 0; i < 100; i++ {
+		codes := buildCodeMap(freqs)
+		for sym := range wantCodes {
+			if codes[sym] != wantCodes[sym] {
+				t.Fatalf("codes[%q] == %q; want %q", rune(sym), codes[sym], wantCodes[sym])
+			}
+		}
+	}
+}
+
+func TestWriteTreeDOT(t *testing.T) {
+	buf := new(bytes.Buffer)
+	assert.NoError(t, WriteTreeDOT(buf, map[uint16]int{'a': 3, 'b': 1, '"': 1}))
+	assert.Equal(t, `digraph huffman {
+	n [shape=circle, label="5"];
+	n -> n0 [label="0"];
+	n -> n1 [label="1"];
+	n0 [shape=circle, label="2"];
+	n0 -> n00 [label="0"];
+	n0 -> n01 [label="1"];
+	n00 [shape=box, label="\"\n1\n00"];
+	n01 [shape=box, label="b\n1\n01"];
+	n1 [shape=box, label="a\n3\n1"];
+}
+`, buf.String())
+
+	buf.Reset()
+	assert.NoError(t, WriteTreeDOT(buf, nil))
+	assert.Equal(t, "digraph huffman {\n}\n", buf.String())
+}
+
+func TestWriteTreeJSON(t *testing.T) {
+	buf := new(bytes.Buffer)
+	assert.NoError(t, WriteTreeJSON(buf, map[uint16]int{'a': 3, 'b': 1, 0x100: 1}))
+	assert.JSONEq(t, `{
+		"freq": 5, "code": "",
+		"left": {
+			"freq": 2, "code": "0",
+			"left": {"symbol": 98, "freq": 1, "code": "00"},
+			"right": {"symbol": 256, "freq": 1, "code": "01"}
+		},
+		"right": {"symbol": 97, "freq": 3, "code": "1"}
+	}`, buf.String())
+
+	buf.Reset()
+	assert.NoError(t, WriteTreeJSON(buf, map[uint16]int{0: 7}))
+	assert.JSONEq(t, `{"symbol": 0, "freq": 7, "code": ""}`, buf.String())
+
+	buf.Reset()
+	assert.NoError(t, WriteTreeJSON(buf, nil))
+	assert.JSONEq(t, `null`, buf.String())
+}
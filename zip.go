@@ -0,0 +1,44 @@
+package hzip
+
+import (
+	"archive/zip"
+	"io"
+)
+
+// RegisterZip registers hzip as a compression method for archive/zip with
+// the given method ID, so that zip.FileHeader.Method can be set to it. The
+// method isn't standard, so archives that use it can only be read by programs
+// that register the same ID. Like zip.RegisterCompressor, it panics if the
+// method is already registered.
+func RegisterZip(method uint16) {
+	zip.RegisterCompressor(method, func(w io.Writer) (io.WriteCloser, error) {
+		return NewWriter(w), nil
+	})
+	zip.RegisterDecompressor(method, func(r io.Reader) io.ReadCloser {
+		return &lazyReader{r: r}
+	})
+}
+
+// lazyReader is an io.ReadCloser that only reads the header when Read is
+// first called, for APIs that have no way of returning an error when they
+// create the reader.
+type lazyReader struct {
+	r   io.Reader
+	hr  *Reader
+	err error
+}
+
+func (r *lazyReader) Read(p []byte) (int, error) {
+	if r.hr == nil && r.err == nil {
+		r.hr, r.err = NewReader(r.r)
+	}
+	if r.err != nil {
+		return 0, r.err
+	}
+	return r.hr.Read(p)
+}
+
+// Close does nothing. The underlying io.Reader is closed by its owner.
+func (r *lazyReader) Close() error {
+	return nil
+}
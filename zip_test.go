@@ -0,0 +1,63 @@
+package hzip
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testZipMethod = 0x687a
+
+func TestZipRoundTrip(t *testing.T) {
+	RegisterZip(testZipMethod)
+	assert.Panics(t, func() { RegisterZip(testZipMethod) })
+
+	files := map[string][]byte{
+		"empty":      nil,
+		"hello.txt":  []byte("Hello World\n"),
+		"random.bin": genRandBytes(10000),
+	}
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	for name, data := range files {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: testZipMethod})
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(data)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(files), len(zr.File))
+	for _, f := range zr.File {
+		assert.Equal(t, uint16(testZipMethod), f.Method)
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Close()
+		assert.Equal(t, string(files[f.Name]), string(data))
+	}
+}
+
+func TestLazyReaderError(t *testing.T) {
+	r := &lazyReader{r: bytes.NewReader([]byte{0x01})}
+	_, err := r.Read(make([]byte, 1))
+	assert.NotNil(t, err)
+	// The error sticks
+	_, err2 := r.Read(make([]byte, 1))
+	assert.Equal(t, err, err2)
+}